@@ -0,0 +1,418 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/defilan/issueparser/internal/analyzer"
+	"github.com/defilan/issueparser/internal/config"
+	"github.com/defilan/issueparser/internal/llm"
+	"github.com/defilan/issueparser/internal/report"
+)
+
+// analyzeFlags configures the LLM connection and the analysis.
+type analyzeFlags struct {
+	llmEndpoint string
+	llmModel    string
+	llmProvider string
+	llmKeyEnv   string
+	llmKeyFile  string
+	llmHeaders  headerFlags
+	llmCert     string
+	llmKey      string
+	llmCA       string
+	llmRetries  int
+	llmTimeout  time.Duration
+	llmBreaker  int
+	structured  string
+	stream      bool
+	verbose     bool
+	contextSize int
+	classify    bool
+	strategy    string
+	embedModel  string
+	clusterSim  float64
+	minCluster  int
+	concurrency int
+	maxPrompt   int
+	batchIssues int
+	maxRepairs  int
+	dropQuotes  bool
+	batchTemp   float64
+	batchTopP   float64
+	synthTemp   float64
+	synthTopP   float64
+	repeatPen   float64
+	seed        int
+	cacheDir    string
+	cacheTTL    time.Duration
+	cacheMaxMB  int64
+	noCache     bool
+	refresh     bool
+
+	// Only settable in the config file
+	configKey      string
+	configHeaders  map[string]string
+	configSampling config.Sampling
+	prompts        analyzer.Prompts
+	profiles       []config.Profile
+	set            configApplier
+
+	// Set by setup
+	provider          llm.Provider
+	cache             *llm.CachedProvider
+	batchSampling     *llm.Sampling
+	synthesisSampling *llm.Sampling
+}
+
+func (f *analyzeFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.llmEndpoint, "llm-endpoint", "http://qwen-14b-issueparser-service:8080", "LLMKube service endpoint")
+	fs.StringVar(&f.llmModel, "llm-model", "qwen-2.5-14b", "Model name for API calls")
+	fs.StringVar(&f.llmProvider, "llm-provider", llm.ProviderOpenAI,
+		"LLM API: openai (OpenAI-compatible), ollama (native /api/chat) or anthropic (Messages API)")
+	fs.StringVar(&f.llmKeyEnv, "llm-api-key-env", "LLM_API_KEY",
+		"Environment variable holding the LLM API key (ANTHROPIC_API_KEY is also read for anthropic)")
+	fs.StringVar(&f.llmKeyFile, "llm-api-key-file", "", "File holding the LLM API key (overrides --llm-api-key-env)")
+	fs.Var(&f.llmHeaders, "llm-header", "Extra header for LLM requests as \"Name: value\" (repeatable)")
+	fs.StringVar(&f.llmCert, "llm-client-cert", "", "Client certificate (PEM) for mTLS to the LLM endpoint")
+	fs.StringVar(&f.llmKey, "llm-client-key", "", "Client private key (PEM) for mTLS to the LLM endpoint")
+	fs.StringVar(&f.llmCA, "llm-ca-cert", "", "CA certificate (PEM) to trust for the LLM endpoint")
+	fs.BoolVar(&f.stream, "stream", false,
+		"Stream LLM responses to show progress and stop output that degenerates into repetition")
+	fs.StringVar(&f.structured, "structured-output", string(llm.StructuredJSONSchema),
+		"How JSON schemas are sent to the LLM: json_schema, json_object, llamacpp or off")
+	fs.IntVar(&f.llmRetries, "llm-retries", 3, "Maximum attempts per LLM request (1 disables retries)")
+	fs.DurationVar(&f.llmTimeout, "llm-request-timeout", 0, "Timeout per LLM request attempt, including streamed responses (0 = 5m)")
+	fs.IntVar(&f.llmBreaker, "llm-breaker-threshold", 3,
+		"Abort after this many consecutive failed LLM requests (0 disables)")
+	fs.IntVar(&f.maxRepairs, "max-repair-attempts", 2,
+		"Follow-up requests asking the LLM to fix malformed or truncated JSON (0 disables)")
+	fs.Float64Var(&f.batchTemp, "batch-temperature", 0.2,
+		"Sampling temperature for batch analysis, classification and cluster naming")
+	fs.Float64Var(&f.batchTopP, "batch-top-p", 0.9, "Nucleus sampling top_p for batch analysis (0 = server default)")
+	fs.Float64Var(&f.synthTemp, "synthesis-temperature", 0.7, "Sampling temperature for merging and synthesizing themes")
+	fs.Float64Var(&f.synthTopP, "synthesis-top-p", 0.9, "Nucleus sampling top_p for synthesis (0 = server default)")
+	fs.Float64Var(&f.repeatPen, "repeat-penalty", 1.15, "Repetition penalty for llama.cpp and Ollama (0 = server default)")
+	fs.IntVar(&f.seed, "seed", -1, "Sampling seed for reproducible runs (-1 = random)")
+	fs.StringVar(&f.cacheDir, "cache-dir", "", "Cache LLM responses in this directory (default no cache)")
+	fs.DurationVar(&f.cacheTTL, "cache-ttl", 7*24*time.Hour, "Age after which cached LLM responses are ignored (0 = never)")
+	fs.Int64Var(&f.cacheMaxMB, "cache-max-size-mb", 500, "Evict least recently used cache entries beyond this size (0 = unlimited)")
+	fs.BoolVar(&f.noCache, "no-cache", false, "Do not read or write the LLM response cache")
+	fs.BoolVar(&f.refresh, "refresh", false, "Ignore cached LLM responses but store the new ones")
+	fs.IntVar(&f.concurrency, "concurrency", 1, "Parallel LLM requests (match the server's --parallel slots)")
+	fs.IntVar(&f.contextSize, "context-window", 4096, "Model context window in tokens (sizes batch and synthesis prompts)")
+	fs.IntVar(&f.maxPrompt, "max-prompt-tokens", 0, "Cap on prompt tokens below the context window (0 = derive from window)")
+	fs.IntVar(&f.batchIssues, "max-batch-issues", 20, "Maximum issues per batch, even when more would fit")
+	fs.BoolVar(&f.dropQuotes, "drop-unverified-quotes", false,
+		"Remove quotes that cannot be found in the source issues instead of marking them")
+	fs.BoolVar(&f.classify, "classify", false, "Classify each issue individually (adds a per-issue table to the report)")
+	fs.StringVar(&f.strategy, "strategy", analyzer.StrategyBatch,
+		"Theme strategy: batch (LLM themes batches of issues) or cluster (embedding clusters named by the LLM)")
+	fs.StringVar(&f.embedModel, "embedding-model", "", "Model name for embeddings (defaults to --llm-model)")
+	fs.Float64Var(&f.clusterSim, "cluster-threshold", 0.75, "Minimum cosine similarity to merge issue clusters")
+	fs.IntVar(&f.minCluster, "min-cluster-size", 2, "Smallest cluster reported as a theme")
+	fs.BoolVar(&f.verbose, "verbose", false, "Enable verbose output")
+}
+
+func (f *analyzeFlags) applyConfig(cfg *config.Config, set configApplier) {
+	f.set = set
+	if cfg == nil {
+		return
+	}
+
+	l := cfg.LLM
+	set.str(&f.llmProvider, "llm-provider", l.Provider)
+	set.str(&f.llmEndpoint, "llm-endpoint", l.Endpoint)
+	set.str(&f.llmModel, "llm-model", l.Model)
+	set.str(&f.llmKeyEnv, "llm-api-key-env", l.APIKeyEnv)
+	set.str(&f.llmKeyFile, "llm-api-key-file", l.APIKeyFile)
+	set.str(&f.llmCert, "llm-client-cert", l.ClientCert)
+	set.str(&f.llmKey, "llm-client-key", l.ClientKey)
+	set.str(&f.llmCA, "llm-ca-cert", l.CACert)
+	set.int(&f.llmRetries, "llm-retries", l.Retries)
+	set.duration(&f.llmTimeout, "llm-request-timeout", l.RequestTimeout)
+	set.int(&f.llmBreaker, "llm-breaker-threshold", l.BreakerThreshold)
+	set.str(&f.structured, "structured-output", l.StructuredOutput)
+	set.bool(&f.stream, "stream", l.Stream)
+	set.int(&f.concurrency, "concurrency", l.Concurrency)
+	set.int(&f.contextSize, "context-window", l.ContextWindow)
+	f.configKey = l.APIKey
+	f.configHeaders = l.Headers
+
+	a := cfg.Analysis
+	set.str(&f.strategy, "strategy", a.Strategy)
+	set.bool(&f.classify, "classify", a.Classify)
+	set.str(&f.embedModel, "embedding-model", a.EmbeddingModel)
+	set.float(&f.clusterSim, "cluster-threshold", a.ClusterThreshold)
+	set.int(&f.minCluster, "min-cluster-size", a.MinClusterSize)
+	set.int(&f.maxPrompt, "max-prompt-tokens", a.MaxPromptTokens)
+	set.int(&f.batchIssues, "max-batch-issues", a.MaxBatchIssues)
+	set.int(&f.maxRepairs, "max-repair-attempts", a.MaxRepairAttempts)
+	set.bool(&f.dropQuotes, "drop-unverified-quotes", a.DropUnverifiedQuotes)
+	set.bool(&f.verbose, "verbose", a.Verbose)
+
+	c := cfg.Cache
+	set.str(&f.cacheDir, "cache-dir", c.Dir)
+	set.duration(&f.cacheTTL, "cache-ttl", c.TTL)
+	set.int64(&f.cacheMaxMB, "cache-max-size-mb", c.MaxSizeMB)
+	set.bool(&f.noCache, "no-cache", c.Disabled)
+	set.bool(&f.refresh, "refresh", c.Refresh)
+
+	f.configSampling = cfg.Sampling
+	f.prompts = analyzer.Prompts(cfg.Prompts)
+	f.profiles = cfg.Profiles
+}
+
+// setup validates the flags and connects the LLM provider, so a run fails
+// before fetching anything if the LLM settings are wrong.
+func (f *analyzeFlags) setup() error {
+	structuredMode, err := llm.ParseStructuredMode(f.structured)
+	if err != nil {
+		return err
+	}
+
+	if f.strategy != analyzer.StrategyBatch && f.strategy != analyzer.StrategyCluster {
+		return fmt.Errorf("invalid strategy: %s (expected batch or cluster)", f.strategy)
+	}
+
+	retryPolicy := llm.DefaultRetryPolicy()
+	retryPolicy.MaxAttempts = f.llmRetries
+	apiKey := f.configKey
+	if apiKey == "" || f.set["llm-api-key-env"] || f.set["llm-api-key-file"] {
+		if apiKey, err = llm.ReadAPIKey(f.llmKeyEnv, f.llmKeyFile); err != nil {
+			return err
+		}
+	}
+	if apiKey == "" && f.llmProvider == llm.ProviderAnthropic {
+		apiKey = os.Getenv("ANTHROPIC_API_KEY")
+	}
+	headers, err := f.llmHeaders.header()
+	if err != nil {
+		return err
+	}
+	for name, value := range f.configHeaders {
+		if headers.Get(name) == "" {
+			headers.Set(name, value)
+		}
+	}
+	tlsConfig, err := llm.LoadTLSConfig(f.llmCert, f.llmKey, f.llmCA)
+	if err != nil {
+		return err
+	}
+
+	f.provider, err = llm.NewProvider(f.llmProvider, f.llmEndpoint, f.llmModel, llm.Options{
+		Retry:            retryPolicy,
+		RequestTimeout:   f.llmTimeout,
+		BreakerThreshold: f.llmBreaker,
+		StructuredOutput: structuredMode,
+		APIKey:           apiKey,
+		Headers:          headers,
+		TLS:              tlsConfig,
+		Stream:           f.stream,
+	})
+	if err != nil {
+		return err
+	}
+	if _, ok := f.provider.(llm.Embedder); !ok && f.strategy == analyzer.StrategyCluster {
+		return fmt.Errorf("the %s provider has no embeddings API, use --strategy=batch", f.llmProvider)
+	}
+
+	if !f.noCache && f.cacheDir != "" {
+		f.cache, err = llm.NewCachedProvider(f.provider, llm.CacheOptions{
+			Dir:     f.cacheDir,
+			TTL:     f.cacheTTL,
+			MaxSize: f.cacheMaxMB * 1024 * 1024,
+			Refresh: f.refresh,
+
+			Provider:         f.llmProvider,
+			Endpoint:         f.llmEndpoint,
+			StructuredOutput: structuredMode,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v, continuing without the response cache\n", err)
+		} else {
+			f.provider = f.cache
+		}
+	}
+
+	f.batchSampling = samplingProfile(f.batchTemp, f.batchTopP, f.repeatPen, f.seed)
+	f.synthesisSampling = samplingProfile(f.synthTemp, f.synthTopP, f.repeatPen, f.seed)
+	f.set.sampling(f.batchSampling, f.configSampling.Batch, "batch-temperature", "batch-top-p")
+	f.set.sampling(f.synthesisSampling, f.configSampling.Synthesis, "synthesis-temperature", "synthesis-top-p")
+	return nil
+}
+
+// analyze runs the analysis on a dataset, once per profile if the config
+// file defines any. classify forces the per-issue classification pass, e.g.
+// when a classification CSV was requested.
+func (f *analyzeFlags) analyze(ctx context.Context, data *dataset, classify bool) (*analysisFile, error) {
+	fmt.Printf("LLM Endpoint: %s (%s, model %s)\n", f.llmEndpoint, f.llmProvider, f.provider.Model())
+	fmt.Printf("Sampling: batch %s; synthesis %s\n", f.batchSampling, f.synthesisSampling)
+	if f.cache != nil {
+		fmt.Printf("Response cache: %s\n", f.cacheDir)
+	}
+
+	fmt.Printf("\nTotal issues to analyze: %d\n", len(data.Issues))
+	fmt.Println("\nAnalyzing issues with LLM (this may take a while)...")
+
+	opts := analyzer.Options{
+		FocusAreas:    data.Keywords,
+		Verbose:       f.verbose,
+		ContextWindow: f.contextSize,
+		Classify:      f.classify || classify,
+		Concurrency:   f.concurrency,
+
+		MaxPromptTokens: f.maxPrompt,
+		MaxBatchIssues:  f.batchIssues,
+
+		MaxRepairAttempts:    repairAttempts(f.maxRepairs),
+		DropUnverifiedQuotes: f.dropQuotes,
+
+		BatchSampling:     f.batchSampling,
+		SynthesisSampling: f.synthesisSampling,
+		Prompts:           f.prompts,
+
+		Strategy:         f.strategy,
+		EmbeddingModel:   f.embedModel,
+		ClusterThreshold: f.clusterSim,
+		MinClusterSize:   f.minCluster,
+	}
+
+	result := &analysisFile{
+		CreatedAt:  time.Now(),
+		Repos:      data.Repos,
+		Keywords:   data.Keywords,
+		IssueCount: len(data.Issues),
+		Model:      f.provider.Model(),
+		Provider:   f.llmProvider,
+		Sampling: []report.StageSampling{
+			{Stage: "Batch", Sampling: *f.batchSampling},
+			{Stage: "Synthesis", Sampling: *f.synthesisSampling},
+		},
+	}
+
+	if len(f.profiles) == 0 {
+		// Analyze issues for themes
+		analysis, err := analyzer.New(f.provider).AnalyzeIssues(ctx, data.Issues, opts)
+		if err != nil {
+			return nil, fmt.Errorf("analyzing issues: %w", err)
+		}
+		result.Analysis = analysis
+	} else {
+		profiles, err := f.analyzeProfiles(ctx, data, opts)
+		if err != nil {
+			return nil, err
+		}
+		result.Profiles = profiles
+	}
+
+	if f.cache != nil {
+		stats := f.cache.Stats()
+		fmt.Printf("\nResponse cache: %d hits, %d misses\n", stats.Hits, stats.Misses)
+	}
+
+	return result, nil
+}
+
+// runAnalyze implements "issueparser analyze": analyze a dataset file into
+// an analysis file.
+func runAnalyze(args []string) error {
+	fs := flag.NewFlagSet("analyze", flag.ExitOnError)
+	var f analyzeFlags
+	f.register(fs)
+	input := fs.String("input", "issues.json", "Dataset file written by \"issueparser fetch\"")
+	output := fs.String("output", "analysis.json", "Analysis file to write")
+	configPath := configFlag(fs)
+	_ = fs.Parse(args)
+
+	cfg, set, err := loadConfig(fs, *configPath)
+	if err != nil {
+		return err
+	}
+	f.applyConfig(cfg, set)
+	if cfg != nil {
+		set.str(input, "input", cfg.Output.Dataset)
+		set.str(output, "output", cfg.Output.Analysis)
+	}
+
+	if err := f.setup(); err != nil {
+		return err
+	}
+
+	var data dataset
+	if err := readJSON(*input, &data); err != nil {
+		return fmt.Errorf("read dataset: %w", err)
+	}
+	if len(data.Issues) == 0 {
+		return fmt.Errorf("%s contains no issues", *input)
+	}
+
+	result, err := f.analyze(context.Background(), &data, false)
+	if err != nil {
+		return err
+	}
+	if err := writeJSON(*output, result); err != nil {
+		return fmt.Errorf("write analysis: %w", err)
+	}
+
+	fmt.Printf("\nAnalysis saved to: %s\n", *output)
+	if result.Analysis != nil {
+		fmt.Printf("Themes identified: %d\n", len(result.Analysis.Themes))
+	}
+	for _, p := range result.Profiles {
+		fmt.Printf("Themes identified for %s: %d\n", p.Name, len(p.Analysis.Themes))
+	}
+	printUsage(result.usage(), analyzer.Pricing{})
+	return nil
+}
+
+// repairAttempts maps the flag value to analyzer.Options, where 0 means the
+// default and a negative value disables follow-up requests.
+func repairAttempts(n int) int {
+	if n <= 0 {
+		return -1
+	}
+	return n
+}
+
+// samplingProfile builds a stage's sampling profile from the flags, keeping
+// the default presence penalty and stop sequences.
+func samplingProfile(temperature, topP, repeatPenalty float64, seed int) *llm.Sampling {
+	sampling := llm.DefaultSampling()
+	sampling.Temperature = llm.Float(temperature)
+	sampling.TopP = topP
+	sampling.RepeatPenalty = repeatPenalty
+	if seed >= 0 {
+		sampling.Seed = llm.Int(seed)
+	}
+	return &sampling
+}
+
+// headerFlags collects repeated --llm-header flags.
+type headerFlags []string
+
+func (h *headerFlags) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *headerFlags) Set(value string) error {
+	*h = append(*h, value)
+	return nil
+}
+
+func (h headerFlags) header() (http.Header, error) {
+	header := make(http.Header)
+	for _, raw := range h {
+		name, value, err := llm.ParseHeader(raw)
+		if err != nil {
+			return nil, err
+		}
+		header.Add(name, value)
+	}
+	return header, nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"time"
+
+	"github.com/defilan/issueparser/internal/config"
+	"github.com/defilan/issueparser/internal/llm"
+)
+
+// configFlag registers --config on a command's flag set.
+func configFlag(fs *flag.FlagSet) *string {
+	return fs.String("config", "", "YAML or JSON file with run settings; flags given on the command line override it")
+}
+
+// loadConfig loads the config file, if any, after fs was parsed. The
+// returned applier remembers which flags were set explicitly.
+func loadConfig(fs *flag.FlagSet, path string) (*config.Config, configApplier, error) {
+	set := configApplier{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if path == "" {
+		return nil, set, nil
+	}
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cfg, set, nil
+}
+
+// configApplier copies config file values into flag variables, except for
+// flags given on the command line, which take precedence. Unset config
+// values (empty strings, nil pointers) leave the flag default alone.
+type configApplier map[string]bool
+
+func (set configApplier) str(dst *string, name, v string) {
+	if v != "" && !set[name] {
+		*dst = v
+	}
+}
+
+func (set configApplier) list(dst *string, name string, v []string) {
+	if len(v) > 0 && !set[name] {
+		*dst = strings.Join(v, ",")
+	}
+}
+
+func (set configApplier) int(dst *int, name string, v *int) {
+	if v != nil && !set[name] {
+		*dst = *v
+	}
+}
+
+func (set configApplier) int64(dst *int64, name string, v *int64) {
+	if v != nil && !set[name] {
+		*dst = *v
+	}
+}
+
+func (set configApplier) float(dst *float64, name string, v *float64) {
+	if v != nil && !set[name] {
+		*dst = *v
+	}
+}
+
+func (set configApplier) bool(dst *bool, name string, v *bool) {
+	if v != nil && !set[name] {
+		*dst = *v
+	}
+}
+
+func (set configApplier) duration(dst *time.Duration, name string, v *time.Duration) {
+	if v != nil && !set[name] {
+		*dst = *v
+	}
+}
+
+// sampling applies a config sampling profile on top of the one built from
+// the flags. Fields without a flag of their own always apply.
+func (set configApplier) sampling(s *llm.Sampling, p config.SamplingProfile, temperatureFlag, topPFlag string) {
+	if p.Temperature != nil && !set[temperatureFlag] {
+		s.Temperature = llm.Float(*p.Temperature)
+	}
+	if p.TopP != nil && !set[topPFlag] {
+		s.TopP = *p.TopP
+	}
+	if p.RepeatPenalty != nil && !set["repeat-penalty"] {
+		s.RepeatPenalty = *p.RepeatPenalty
+	}
+	if p.Seed != nil && !set["seed"] {
+		s.Seed = nil
+		if *p.Seed >= 0 {
+			s.Seed = llm.Int(*p.Seed)
+		}
+	}
+	if p.PresencePenalty != nil {
+		s.PresencePenalty = *p.PresencePenalty
+	}
+	if p.Stop != nil {
+		s.Stop = p.Stop
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/defilan/issueparser/internal/config"
+	"github.com/defilan/issueparser/internal/github"
+	"github.com/defilan/issueparser/internal/store"
+)
+
+// fetchFlags selects which issues are fetched and where from.
+type fetchFlags struct {
+	repos       string
+	labels      string
+	keywords    string
+	kind        string
+	maxIssues   int
+	comments    bool
+	maxComments int
+	storeDir    string
+	offline     bool
+	fullSync    bool
+
+	itemKind github.ItemKind
+	cfg      *config.Config // per-repo labels and keywords
+	set      configApplier
+}
+
+func (f *fetchFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.repos, "repos", "ollama/ollama,vllm-project/vllm", "Comma-separated repos (owner/repo)")
+	fs.StringVar(&f.labels, "labels", "", "Filter by labels (comma-separated)")
+	fs.StringVar(&f.kind, "kind", "issues", "Items to analyze: issues, prs or all")
+	fs.StringVar(&f.keywords, "keywords", "multi-gpu,scale,concurrency,production,performance",
+		"Keywords to search for in issues")
+	fs.IntVar(&f.maxIssues, "max-issues", 100, "Maximum issues to fetch per repo")
+	fs.BoolVar(&f.comments, "comments", false, "Fetch issue comment threads and include excerpts in the analysis")
+	fs.IntVar(&f.maxComments, "max-comments", 10, "Maximum comments to fetch per issue (with --comments)")
+	fs.StringVar(&f.storeDir, "store-dir", "", "Keep fetched issues in this directory and only fetch what changed since the last run")
+	fs.BoolVar(&f.offline, "offline", false, "Analyze the issues in --store-dir without contacting GitHub")
+	fs.BoolVar(&f.fullSync, "full-sync", false, "Refetch every issue into --store-dir instead of only changed ones")
+}
+
+func (f *fetchFlags) applyConfig(cfg *config.Config, set configApplier) {
+	f.set = set
+	if cfg == nil {
+		return
+	}
+	f.cfg = cfg
+
+	set.list(&f.repos, "repos", cfg.RepoNames())
+	set.list(&f.labels, "labels", cfg.Labels)
+	set.list(&f.keywords, "keywords", cfg.Keywords)
+	set.str(&f.kind, "kind", cfg.Kind)
+	set.int(&f.maxIssues, "max-issues", cfg.MaxIssues)
+	set.bool(&f.comments, "comments", cfg.Comments)
+	set.int(&f.maxComments, "max-comments", cfg.MaxComments)
+	set.str(&f.storeDir, "store-dir", cfg.StoreDir)
+}
+
+// filters returns the labels and keywords for repo: its own from the
+// config file, unless --labels or --keywords were given, or the general ones.
+func (f *fetchFlags) filters(repo string) (labels, keywords []string) {
+	labels, keywords = strings.Split(f.labels, ","), strings.Split(f.keywords, ",")
+	if f.cfg == nil {
+		return labels, keywords
+	}
+
+	if r, ok := f.cfg.Repo(repo); ok {
+		if len(r.Labels) > 0 && !f.set["labels"] {
+			labels = r.Labels
+		}
+		if len(r.Keywords) > 0 && !f.set["keywords"] {
+			keywords = r.Keywords
+		}
+	}
+	return labels, keywords
+}
+
+func (f *fetchFlags) validate() error {
+	var err error
+	if f.itemKind, err = github.ParseItemKind(f.kind); err != nil {
+		return err
+	}
+	if f.offline && f.storeDir == "" {
+		return fmt.Errorf("--offline needs --store-dir")
+	}
+	return nil
+}
+
+// fetch collects the matching issues of every repo, from GitHub or the
+// local store.
+func (f *fetchFlags) fetch(ctx context.Context) (*dataset, error) {
+	// Get GitHub token from environment
+	ghToken := os.Getenv("GITHUB_TOKEN")
+	if ghToken == "" && !f.offline {
+		fmt.Fprintln(os.Stderr, "Warning: GITHUB_TOKEN not set, API rate limits will be restrictive")
+	}
+	ghClient := github.NewClient(ghToken)
+
+	var issueStore *store.Store
+	if f.storeDir != "" {
+		var err error
+		if issueStore, err = store.Open(f.storeDir); err != nil {
+			return nil, err
+		}
+	}
+
+	fmt.Printf("Repos: %s\n", f.repos)
+	fmt.Printf("Keywords: %s\n", f.keywords)
+	fmt.Println()
+
+	data := &dataset{FetchedAt: time.Now()}
+
+	// Fetch issues from each repo
+	for _, repo := range strings.Split(f.repos, ",") {
+		repo = strings.TrimSpace(repo)
+		parts := strings.Split(repo, "/")
+		if len(parts) != 2 {
+			fmt.Fprintf(os.Stderr, "Invalid repo format: %s (expected owner/repo)\n", repo)
+			continue
+		}
+		data.Repos = append(data.Repos, repo)
+
+		labels, keywords := f.filters(repo)
+		data.Keywords = appendNew(data.Keywords, keywords...)
+
+		var issues []github.Issue
+		var err error
+		if issueStore != nil {
+			issues, err = storedIssues(ctx, issueStore, ghClient, parts[0], parts[1], f.offline, f.fullSync, store.Query{
+				Labels:   labels,
+				Keywords: keywords,
+				MaxItems: f.maxIssues,
+				State:    "all",
+
+				IncludeComments: f.comments,
+				MaxComments:     f.maxComments,
+				Kind:            f.itemKind,
+			})
+		} else {
+			fmt.Printf("Fetching issues from %s...\n", repo)
+			issues, err = ghClient.FetchIssues(ctx, parts[0], parts[1], github.FetchOptions{
+				Labels:   labels,
+				Keywords: keywords,
+				MaxItems: f.maxIssues,
+				State:    "all", // both open and closed
+
+				IncludeComments: f.comments,
+				MaxComments:     f.maxComments,
+				Kind:            f.itemKind,
+			})
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error fetching issues from %s: %v\n", repo, err)
+			continue
+		}
+
+		fmt.Printf("  Found %d relevant issues\n", len(issues))
+		data.Issues = append(data.Issues, issues...)
+	}
+
+	return data, nil
+}
+
+// appendNew appends the non-empty values not yet in list.
+func appendNew(list []string, values ...string) []string {
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v != "" && !slices.Contains(list, v) {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// storedIssues syncs owner/repo into the store, unless offline, and answers
+// the query from the stored copy.
+func storedIssues(ctx context.Context, st *store.Store, client *github.Client, owner, repo string,
+	offline, full bool, q store.Query) ([]github.Issue, error) {
+	name := owner + "/" + repo
+	if offline {
+		synced, err := st.LastSync(name)
+		if err != nil {
+			return nil, err
+		}
+		if synced.IsZero() {
+			return nil, fmt.Errorf("%s was never synced, run without --offline first", name)
+		}
+		fmt.Printf("Loading stored issues for %s (synced %s)...\n", name, synced.Format(time.RFC3339))
+		return st.Issues(name, q)
+	}
+
+	fmt.Printf("Syncing issues from %s...\n", name)
+	result, err := st.Sync(ctx, client, owner, repo, store.SyncOptions{
+		Kind:            q.Kind,
+		IncludeComments: q.IncludeComments,
+		MaxComments:     q.MaxComments,
+		Full:            full,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Incremental {
+		fmt.Printf("  %d items changed since the last sync, %d stored\n", result.Fetched, result.Total)
+	} else {
+		fmt.Printf("  Fetched %d items, %d stored\n", result.Fetched, result.Total)
+	}
+	return st.Issues(name, q)
+}
+
+// runFetch implements "issueparser fetch": fetch issues into a dataset file.
+func runFetch(args []string) error {
+	fs := flag.NewFlagSet("fetch", flag.ExitOnError)
+	var f fetchFlags
+	f.register(fs)
+	output := fs.String("output", "issues.json", "Dataset file to write")
+	configPath := configFlag(fs)
+	_ = fs.Parse(args)
+
+	cfg, set, err := loadConfig(fs, *configPath)
+	if err != nil {
+		return err
+	}
+	f.applyConfig(cfg, set)
+	if cfg != nil {
+		set.str(output, "output", cfg.Output.Dataset)
+	}
+
+	if err := f.validate(); err != nil {
+		return err
+	}
+
+	data, err := f.fetch(context.Background())
+	if err != nil {
+		return err
+	}
+	if err := writeJSON(*output, data); err != nil {
+		return fmt.Errorf("write dataset: %w", err)
+	}
+
+	fmt.Printf("\nSaved %d issues to %s\n", len(data.Issues), *output)
+	return nil
+}
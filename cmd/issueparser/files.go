@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/defilan/issueparser/internal/analyzer"
+	"github.com/defilan/issueparser/internal/github"
+	"github.com/defilan/issueparser/internal/report"
+)
+
+// dataset is the file written by "issueparser fetch": the fetched issues
+// and the query that selected them.
+type dataset struct {
+	FetchedAt time.Time      `json:"fetched_at"`
+	Repos     []string       `json:"repos"`
+	Keywords  []string       `json:"keywords"`
+	Issues    []github.Issue `json:"issues"`
+}
+
+// analysisFile is the file written by "issueparser analyze": the analysis
+// and the run details the report describes in its methodology section.
+// Runs with analysis profiles have one analysis per profile instead.
+type analysisFile struct {
+	CreatedAt  time.Time              `json:"created_at"`
+	Repos      []string               `json:"repos"`
+	Keywords   []string               `json:"keywords"`
+	IssueCount int                    `json:"issue_count"`
+	Model      string                 `json:"model"`
+	Provider   string                 `json:"provider"`
+	Sampling   []report.StageSampling `json:"sampling"`
+	Analysis   *analyzer.Analysis     `json:"analysis,omitempty"`
+	Profiles   []profileAnalysis      `json:"profiles,omitempty"`
+}
+
+// profileAnalysis is the analysis of one profile from the config file.
+type profileAnalysis struct {
+	Name       string             `json:"name"`
+	Title      string             `json:"title,omitempty"`
+	Report     string             `json:"report,omitempty"` // own report file
+	FocusAreas []string           `json:"focus_areas"`
+	IssueCount int                `json:"issue_count"`
+	Analysis   *analyzer.Analysis `json:"analysis"`
+}
+
+func readJSON(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func writeJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
@@ -1,3 +1,11 @@
+// Command issueparser fetches GitHub issues, has an LLM find recurring
+// themes in them and writes a report. Each stage is a subcommand so it can
+// be rerun, debugged or scheduled on its own:
+//
+//	issueparser fetch    fetch issues into a dataset file
+//	issueparser analyze  analyze a dataset into an analysis file
+//	issueparser report   render an analysis file
+//	issueparser run      all three in one go (the default)
 package main
 
 import (
@@ -6,131 +14,101 @@ import (
 	"fmt"
 	"os"
 	"strings"
-
-	"github.com/defilan/issueparser/internal/analyzer"
-	"github.com/defilan/issueparser/internal/github"
-	"github.com/defilan/issueparser/internal/llm"
-	"github.com/defilan/issueparser/internal/report"
 )
 
 func main() {
-	// CLI flags
-	var (
-		repos       string
-		labels      string
-		keywords    string
-		maxIssues   int
-		llmEndpoint string
-		llmModel    string
-		outputFile  string
-		verbose     bool
-	)
-
-	flag.StringVar(&repos, "repos", "ollama/ollama,vllm-project/vllm",
-		"Comma-separated repos (owner/repo)")
-	flag.StringVar(&labels, "labels", "", "Filter by labels (comma-separated)")
-	flag.StringVar(&keywords, "keywords", "multi-gpu,scale,concurrency,production,performance",
-		"Keywords to search for in issues")
-	flag.IntVar(&maxIssues, "max-issues", 100, "Maximum issues to fetch per repo")
-	flag.StringVar(&llmEndpoint, "llm-endpoint", "http://qwen-14b-issueparser-service:8080", "LLMKube service endpoint")
-	flag.StringVar(&llmModel, "llm-model", "qwen-2.5-14b", "Model name for API calls")
-	flag.StringVar(&outputFile, "output", "issue-analysis-report.md", "Output file for the report")
-	flag.BoolVar(&verbose, "verbose", false, "Enable verbose output")
-	flag.Parse()
-
-	ctx := context.Background()
-
-	// Get GitHub token from environment
-	ghToken := os.Getenv("GITHUB_TOKEN")
-	if ghToken == "" {
-		fmt.Fprintln(os.Stderr, "Warning: GITHUB_TOKEN not set, API rate limits will be restrictive")
+	cmd, args := "run", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
 	}
 
-	// Initialize components
-	ghClient := github.NewClient(ghToken)
-	llmClient := llm.NewClient(llmEndpoint, llmModel)
-	themeAnalyzer := analyzer.New(llmClient)
-
-	fmt.Println("=== IssueParser: GitHub Issue Theme Analyzer ===")
-	fmt.Printf("Repos: %s\n", repos)
-	fmt.Printf("Keywords: %s\n", keywords)
-	fmt.Printf("LLM Endpoint: %s\n", llmEndpoint)
-	fmt.Println()
+	var err error
+	switch cmd {
+	case "fetch":
+		err = runFetch(args)
+	case "analyze":
+		err = runAnalyze(args)
+	case "report":
+		err = runReport(args)
+	case "run":
+		err = runAll(args)
+	case "help":
+		usage()
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", cmd)
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
 
-	// Parse repos
-	repoList := strings.Split(repos, ",")
-	keywordList := strings.Split(keywords, ",")
+func usage() {
+	fmt.Fprint(os.Stderr, `Usage: issueparser [command] [options]
 
-	var allIssues []github.Issue
+Commands:
+  fetch    Fetch issues into a dataset file (--output, default issues.json)
+  analyze  Analyze a dataset file (--input) into an analysis file (--output, default analysis.json)
+  report   Render an analysis file (--input) as markdown, json or csv
+  run      Fetch, analyze and report in one go (default when no command is given)
 
-	// Fetch issues from each repo
-	for _, repo := range repoList {
-		repo = strings.TrimSpace(repo)
-		parts := strings.Split(repo, "/")
-		if len(parts) != 2 {
-			fmt.Fprintf(os.Stderr, "Invalid repo format: %s (expected owner/repo)\n", repo)
-			continue
-		}
+Run "issueparser <command> -h" for the options of a command.
+`)
+}
 
-		fmt.Printf("Fetching issues from %s...\n", repo)
-		issues, err := ghClient.FetchIssues(ctx, parts[0], parts[1], github.FetchOptions{
-			Labels:   strings.Split(labels, ","),
-			Keywords: keywordList,
-			MaxItems: maxIssues,
-			State:    "all", // both open and closed
-		})
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error fetching issues from %s: %v\n", repo, err)
-			continue
-		}
+// runAll implements "issueparser run", the whole pipeline without
+// intermediate files.
+func runAll(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	var (
+		fetchOpts   fetchFlags
+		analyzeOpts analyzeFlags
+		reportOpts  reportFlags
+	)
+	fetchOpts.register(fs)
+	analyzeOpts.register(fs)
+	reportOpts.register(fs)
+	configPath := configFlag(fs)
+	_ = fs.Parse(args)
 
-		fmt.Printf("  Found %d relevant issues\n", len(issues))
-		allIssues = append(allIssues, issues...)
+	cfg, set, err := loadConfig(fs, *configPath)
+	if err != nil {
+		return err
 	}
+	fetchOpts.applyConfig(cfg, set)
+	analyzeOpts.applyConfig(cfg, set)
+	reportOpts.applyConfig(cfg, set)
 
-	if len(allIssues) == 0 {
-		fmt.Println("No issues found matching criteria")
-		os.Exit(0)
+	// Check every stage's flags before spending time on the earlier ones
+	if err := fetchOpts.validate(); err != nil {
+		return err
+	}
+	if err := reportOpts.validate(); err != nil {
+		return err
+	}
+	if err := analyzeOpts.setup(); err != nil {
+		return err
 	}
 
-	fmt.Printf("\nTotal issues to analyze: %d\n", len(allIssues))
-	fmt.Println("\nAnalyzing issues with LLM (this may take a while)...")
+	ctx := context.Background()
 
-	// Analyze issues for themes
-	analysis, err := themeAnalyzer.AnalyzeIssues(ctx, allIssues, analyzer.Options{
-		FocusAreas: keywordList,
-		Verbose:    verbose,
-	})
+	fmt.Println("=== IssueParser: GitHub Issue Theme Analyzer ===")
+	data, err := fetchOpts.fetch(ctx)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error analyzing issues: %v\n", err)
-		os.Exit(1)
+		return err
 	}
-
-	// Generate report
-	fmt.Printf("\nGenerating report to %s...\n", outputFile)
-	rpt := report.New(analysis, report.Options{
-		Title:      "GitHub Issue Theme Analysis",
-		Repos:      repoList,
-		Keywords:   keywordList,
-		IssueCount: len(allIssues),
-	})
-
-	if err := rpt.WriteMarkdown(outputFile); err != nil {
-		fmt.Fprintf(os.Stderr, "Error writing report: %v\n", err)
-		os.Exit(1)
+	if len(data.Issues) == 0 {
+		fmt.Println("No issues found matching criteria")
+		return nil
 	}
+	fmt.Println()
 
-	fmt.Println("\n=== Analysis Complete ===")
-	fmt.Printf("Report saved to: %s\n", outputFile)
-	fmt.Printf("Themes identified: %d\n", len(analysis.Themes))
-
-	// Print summary to stdout
-	fmt.Println("\n--- Quick Summary ---")
-	for i, theme := range analysis.Themes {
-		if i >= 5 {
-			fmt.Printf("  ... and %d more themes\n", len(analysis.Themes)-5)
-			break
-		}
-		fmt.Printf("  %d. %s (%d issues)\n", i+1, theme.Name, theme.IssueCount)
+	result, err := analyzeOpts.analyze(ctx, data, reportOpts.wantsClassifications())
+	if err != nil {
+		return err
 	}
+
+	return reportOpts.write(result)
 }
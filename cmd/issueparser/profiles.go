@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/defilan/issueparser/internal/analyzer"
+	"github.com/defilan/issueparser/internal/config"
+	"github.com/defilan/issueparser/internal/github"
+	"github.com/defilan/issueparser/internal/report"
+	"github.com/defilan/issueparser/internal/store"
+)
+
+// analyzeProfiles runs the analysis once per config profile, on the issues
+// of the dataset that match the profile's filters.
+func (f *analyzeFlags) analyzeProfiles(ctx context.Context, data *dataset, opts analyzer.Options) ([]profileAnalysis, error) {
+	var results []profileAnalysis
+	for _, p := range f.profiles {
+		issues := profileIssues(data.Issues, p)
+		fmt.Printf("\n=== Profile %s: %d issues ===\n", p.Name, len(issues))
+		if len(issues) == 0 {
+			fmt.Println("No issues match the profile, skipping it")
+			continue
+		}
+
+		profileOpts := opts
+		if len(p.Focus) > 0 {
+			profileOpts.FocusAreas = p.Focus
+		}
+		profileOpts.Prompts = overridePrompts(opts.Prompts, analyzer.Prompts(p.Prompts))
+
+		analysis, err := analyzer.New(f.provider).AnalyzeIssues(ctx, issues, profileOpts)
+		if err != nil {
+			return nil, fmt.Errorf("analyzing profile %s: %w", p.Name, err)
+		}
+		results = append(results, profileAnalysis{
+			Name:       p.Name,
+			Title:      p.Title,
+			Report:     p.Report,
+			FocusAreas: profileOpts.FocusAreas,
+			IssueCount: len(issues),
+			Analysis:   analysis,
+		})
+	}
+
+	if len(results) == 0 {
+		return nil, fmt.Errorf("no issues match any analysis profile")
+	}
+	return results, nil
+}
+
+// profileIssues returns the issues that pass a profile's label and keyword
+// filters.
+func profileIssues(issues []github.Issue, p config.Profile) []github.Issue {
+	q := store.Query{Labels: p.Labels, Keywords: p.Keywords, Kind: github.KindAll}
+
+	var matched []github.Issue
+	for _, issue := range issues {
+		if q.Matches(issue) {
+			matched = append(matched, issue)
+		}
+	}
+	return matched
+}
+
+// overridePrompts returns base with the prompts set in override replaced.
+func overridePrompts(base, override analyzer.Prompts) analyzer.Prompts {
+	for _, p := range []struct{ dst, src *string }{
+		{&base.Batch, &override.Batch},
+		{&base.Merge, &override.Merge},
+		{&base.Synthesis, &override.Synthesis},
+		{&base.Classify, &override.Classify},
+		{&base.ClusterNaming, &override.ClusterNaming},
+		{&base.ClusterSummary, &override.ClusterSummary},
+	} {
+		if *p.src != "" {
+			*p.dst = *p.src
+		}
+	}
+	return base
+}
+
+// usage returns the LLM usage of the whole analysis, with the usage of
+// profiles added up per stage.
+func (a *analysisFile) usage() []analyzer.StageUsage {
+	if a.Analysis != nil {
+		return a.Analysis.Usage
+	}
+
+	var stages []analyzer.StageUsage
+	index := make(map[string]int)
+	for _, p := range a.Profiles {
+		for _, u := range p.Analysis.Usage {
+			i, ok := index[u.Stage]
+			if !ok {
+				index[u.Stage] = len(stages)
+				stages = append(stages, u)
+				continue
+			}
+			total := analyzer.TotalUsage([]analyzer.StageUsage{stages[i], u})
+			total.Stage = u.Stage
+			stages[i] = total
+		}
+	}
+	return stages
+}
+
+// profile returns the analysis file of a single profile, which renders as a
+// report of its own.
+func (a *analysisFile) profile(p profileAnalysis) *analysisFile {
+	single := *a
+	single.Keywords = p.FocusAreas
+	single.IssueCount = p.IssueCount
+	single.Analysis = p.Analysis
+	single.Profiles = nil
+	return &single
+}
+
+// writeProfiles renders an analysis with profiles: profiles with a report
+// file of their own are written there, the others become sections of the
+// report at --output.
+func (f *reportFlags) writeProfiles(result *analysisFile) error {
+	var sections []profileAnalysis
+	saved := make(map[string]string) // profile name to report file
+	for _, p := range result.Profiles {
+		path := p.Report
+		if path == "" {
+			if f.format != formatCSV {
+				sections = append(sections, p)
+				continue
+			}
+			// A CSV table has no room for sections
+			path = profilePath(f.output, p.Name)
+		}
+
+		title := p.Title
+		if title == "" {
+			title = f.title + ": " + p.Name
+		}
+		fmt.Printf("\nGenerating %s report to %s...\n", p.Name, path)
+		single := result.profile(p)
+		rpt, err := f.render(path, title, single)
+		if err != nil {
+			return err
+		}
+		saved[p.Name] = path
+
+		var csvPath string
+		if f.classifyCSV != "" {
+			csvPath = profilePath(f.classifyCSV, p.Name)
+		}
+		if err := f.writeClassifications(rpt, p.Analysis, csvPath); err != nil {
+			return err
+		}
+	}
+
+	if len(sections) > 0 {
+		fmt.Printf("\nGenerating report to %s...\n", f.output)
+		var err error
+		if f.format == formatJSON {
+			err = writeJSON(f.output, result)
+		} else {
+			err = report.WriteSectionsMarkdown(f.output, f.options(f.title, result), reportSections(sections))
+		}
+		if err != nil {
+			return fmt.Errorf("writing report: %w", err)
+		}
+
+		for _, p := range sections {
+			saved[p.Name] = f.output
+
+			var csvPath string
+			if f.classifyCSV != "" {
+				csvPath = profilePath(f.classifyCSV, p.Name)
+			}
+			rpt := report.New(p.Analysis, f.options(f.title, result.profile(p)))
+			if err := f.writeClassifications(rpt, p.Analysis, csvPath); err != nil {
+				return err
+			}
+		}
+	}
+
+	fmt.Println("\n=== Analysis Complete ===")
+	for _, p := range result.Profiles {
+		fmt.Printf("\n%s (%d issues), report saved to: %s\n", p.Name, p.IssueCount, saved[p.Name])
+		printThemes(p.Analysis)
+	}
+
+	printUsage(result.usage(), f.pricing())
+	return nil
+}
+
+func reportSections(profiles []profileAnalysis) []report.Section {
+	sections := make([]report.Section, len(profiles))
+	for i, p := range profiles {
+		sections[i] = report.Section{
+			Name:       p.Name,
+			FocusAreas: p.FocusAreas,
+			IssueCount: p.IssueCount,
+			Analysis:   p.Analysis,
+		}
+	}
+	return sections
+}
+
+// profilePath derives a profile's file from a shared one, e.g.
+// "report.csv" becomes "report-security.csv".
+func profilePath(path, profile string) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' {
+			return unicode.ToLower(r)
+		}
+		return '-'
+	}, profile)
+
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + name + ext
+}
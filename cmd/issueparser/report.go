@@ -0,0 +1,221 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/defilan/issueparser/internal/analyzer"
+	"github.com/defilan/issueparser/internal/config"
+	"github.com/defilan/issueparser/internal/report"
+)
+
+// Report formats accepted by --format.
+const (
+	formatMarkdown = "markdown"
+	formatJSON     = "json"
+	formatCSV      = "csv" // per-issue classifications only
+)
+
+// reportFlags selects how an analysis is rendered.
+type reportFlags struct {
+	output      string
+	format      string
+	title       string
+	classifyCSV string
+	pricePrompt float64
+	priceOutput float64
+}
+
+func (f *reportFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.output, "output", "", "Output file for the report (default issue-analysis-report.md, .json or .csv)")
+	fs.StringVar(&f.format, "format", formatMarkdown, "Report format: markdown, json (the analysis file) or csv (classifications)")
+	fs.StringVar(&f.title, "title", "GitHub Issue Theme Analysis", "Report title")
+	fs.StringVar(&f.classifyCSV, "classify-csv", "", "Also write the per-issue classification table to this CSV file")
+	fs.Float64Var(&f.pricePrompt, "price-prompt-per-1k", 0, "Price per 1K prompt tokens, to estimate the cost of hosted providers")
+	fs.Float64Var(&f.priceOutput, "price-completion-per-1k", 0, "Price per 1K completion tokens, to estimate the cost of hosted providers")
+}
+
+func (f *reportFlags) applyConfig(cfg *config.Config, set configApplier) {
+	if cfg == nil {
+		return
+	}
+
+	set.str(&f.output, "output", cfg.Output.Report)
+	set.str(&f.format, "format", cfg.Output.Format)
+	set.str(&f.title, "title", cfg.Output.Title)
+	set.str(&f.classifyCSV, "classify-csv", cfg.Output.ClassifyCSV)
+	set.float(&f.pricePrompt, "price-prompt-per-1k", cfg.Pricing.PromptPer1K)
+	set.float(&f.priceOutput, "price-completion-per-1k", cfg.Pricing.CompletionPer1K)
+}
+
+func (f *reportFlags) validate() error {
+	var ext string
+	switch f.format {
+	case formatMarkdown:
+		ext = ".md"
+	case formatJSON:
+		ext = ".json"
+	case formatCSV:
+		ext = ".csv"
+	default:
+		return fmt.Errorf("invalid format %q (expected markdown, json or csv)", f.format)
+	}
+	if f.output == "" {
+		f.output = "issue-analysis-report" + ext
+	}
+	return nil
+}
+
+// wantsClassifications reports whether the report needs the per-issue
+// classification pass.
+func (f *reportFlags) wantsClassifications() bool {
+	return f.format == formatCSV || f.classifyCSV != ""
+}
+
+// write renders the analysis and prints a summary of it.
+func (f *reportFlags) write(result *analysisFile) error {
+	if len(result.Profiles) > 0 {
+		return f.writeProfiles(result)
+	}
+	analysis := result.Analysis
+
+	// Generate report
+	fmt.Printf("\nGenerating report to %s...\n", f.output)
+	rpt, err := f.render(f.output, f.title, result)
+	if err != nil {
+		return err
+	}
+	if err := f.writeClassifications(rpt, analysis, f.classifyCSV); err != nil {
+		return err
+	}
+
+	fmt.Println("\n=== Analysis Complete ===")
+	fmt.Printf("Report saved to: %s\n", f.output)
+	printThemes(analysis)
+	printUsage(analysis.Usage, f.pricing())
+	return nil
+}
+
+func (f *reportFlags) pricing() analyzer.Pricing {
+	return analyzer.Pricing{PromptPer1K: f.pricePrompt, CompletionPer1K: f.priceOutput}
+}
+
+func (f *reportFlags) options(title string, result *analysisFile) report.Options {
+	return report.Options{
+		Title:      title,
+		Repos:      result.Repos,
+		Keywords:   result.Keywords,
+		IssueCount: result.IssueCount,
+		Model:      result.Model,
+		Provider:   result.Provider,
+		Sampling:   result.Sampling,
+		Pricing:    f.pricing(),
+	}
+}
+
+// render writes the analysis of result to path in the chosen format.
+func (f *reportFlags) render(path, title string, result *analysisFile) (*report.Report, error) {
+	rpt := report.New(result.Analysis, f.options(title, result))
+
+	var err error
+	switch f.format {
+	case formatJSON:
+		err = writeJSON(path, result)
+	case formatCSV:
+		err = rpt.WriteClassificationsCSV(path)
+	default:
+		err = rpt.WriteMarkdown(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("writing report: %w", err)
+	}
+	return rpt, nil
+}
+
+// writeClassifications writes the classification table to path, if set,
+// and warns if the analysis has none to write.
+func (f *reportFlags) writeClassifications(rpt *report.Report, analysis *analyzer.Analysis, path string) error {
+	if f.wantsClassifications() && len(analysis.Classifications) == 0 {
+		fmt.Println("Warning: the analysis has no per-issue classifications, rerun it with --classify")
+	}
+	if path == "" {
+		return nil
+	}
+	if err := rpt.WriteClassificationsCSV(path); err != nil {
+		return fmt.Errorf("writing classification CSV: %w", err)
+	}
+	fmt.Printf("Classifications saved to: %s\n", path)
+	return nil
+}
+
+// printThemes prints the number of themes and the top ones.
+func printThemes(analysis *analyzer.Analysis) {
+	fmt.Printf("Themes identified: %d\n", len(analysis.Themes))
+
+	// Print summary to stdout
+	fmt.Println("\n--- Quick Summary ---")
+	for i, theme := range analysis.Themes {
+		if i >= 5 {
+			fmt.Printf("  ... and %d more themes\n", len(analysis.Themes)-5)
+			break
+		}
+		fmt.Printf("  %d. %s (%d issues)\n", i+1, theme.Name, theme.IssueCount)
+	}
+}
+
+// runReport implements "issueparser report": render an analysis file.
+func runReport(args []string) error {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	var f reportFlags
+	f.register(fs)
+	input := fs.String("input", "analysis.json", "Analysis file written by \"issueparser analyze\"")
+	configPath := configFlag(fs)
+	_ = fs.Parse(args)
+
+	cfg, set, err := loadConfig(fs, *configPath)
+	if err != nil {
+		return err
+	}
+	f.applyConfig(cfg, set)
+	if cfg != nil {
+		set.str(input, "input", cfg.Output.Analysis)
+	}
+
+	if err := f.validate(); err != nil {
+		return err
+	}
+
+	var result analysisFile
+	if err := readJSON(*input, &result); err != nil {
+		return fmt.Errorf("read analysis: %w", err)
+	}
+	if result.Analysis == nil && len(result.Profiles) == 0 {
+		return fmt.Errorf("%s contains no analysis", *input)
+	}
+
+	return f.write(&result)
+}
+
+// printUsage prints LLM token usage and latency per stage.
+func printUsage(stages []analyzer.StageUsage, pricing analyzer.Pricing) {
+	if len(stages) == 0 {
+		return
+	}
+
+	fmt.Println("\n--- LLM Usage ---")
+	for _, u := range append(stages, analyzer.TotalUsage(stages)) {
+		fmt.Printf("  %-16s %4d calls  %8d prompt + %7d completion tokens  %8s  %5.1f tok/s",
+			u.Stage+":", u.Calls, u.PromptTokens, u.CompletionTokens, u.Latency.Round(time.Second), u.TokensPerSecond())
+		if !pricing.IsZero() {
+			fmt.Printf("  $%.4f", u.Cost(pricing))
+		}
+		if u.Estimated {
+			fmt.Print("  (estimated)")
+		}
+		if u.CachedCalls > 0 {
+			fmt.Printf("  (+%d cached)", u.CachedCalls)
+		}
+		fmt.Println()
+	}
+}
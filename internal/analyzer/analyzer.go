@@ -2,7 +2,7 @@ package analyzer
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 
@@ -11,251 +11,275 @@ import (
 )
 
 type Analyzer struct {
-	llm *llm.Client
+	llm llm.Provider
 }
 
 type Options struct {
-	FocusAreas []string
-	Verbose    bool
+	FocusAreas    []string
+	Verbose       bool
+	ContextWindow int  // model context window in tokens, used to size synthesis prompts
+	Classify      bool // classify every issue individually before theming
+	Concurrency   int  // LLM requests in flight at once (default 1)
+
+	// Prompt sizing. Batches are packed with as many issues as fit the
+	// context window after reserving room for the response.
+	MaxPromptTokens int // caps prompt size below the context window (0 = window-based)
+	MaxIssueTokens  int // caps a single rendered issue (0 = budget/8)
+	MaxBatchIssues  int // caps issues per batch regardless of size (default 20)
+
+	// MaxRepairAttempts bounds the follow-up requests sent when a response
+	// is malformed or cut off by max_tokens (0 = 2, negative disables)
+	MaxRepairAttempts int
+
+	// Sampling profiles per stage; nil uses llm.DefaultSampling. Batch
+	// covers batch analysis, classification and cluster naming, where
+	// output should stay close to the issues; synthesis covers merging and
+	// summarizing themes.
+	BatchSampling     *llm.Sampling
+	SynthesisSampling *llm.Sampling
+
+	// Prompts replaces the built-in system prompts of individual stages
+	Prompts Prompts
+
+	// DropUnverifiedQuotes removes quotes that cannot be found in the source
+	// issues instead of marking them as unverified
+	DropUnverifiedQuotes bool
+
+	// Strategy selects how themes are found: StrategyBatch (default) has the
+	// LLM theme batches of raw issues, StrategyCluster groups issues by
+	// embedding similarity and only asks the LLM to name each group.
+	Strategy         string
+	EmbeddingModel   string  // defaults to the chat model
+	ClusterThreshold float64 // minimum cosine similarity to merge clusters
+	MinClusterSize   int     // smaller clusters are not reported as themes
+
+	usage *usageTracker // set by AnalyzeIssues for the duration of a run
 }
 
+// Prompts holds custom system prompts; empty fields keep the built-in
+// prompt. A custom prompt must still ask for the stage's JSON structure,
+// since responses are decoded the same way.
+type Prompts struct {
+	Batch          string
+	Merge          string
+	Synthesis      string
+	Classify       string
+	ClusterNaming  string
+	ClusterSummary string
+}
+
+const (
+	StrategyBatch   = "batch"
+	StrategyCluster = "cluster"
+)
+
 type Analysis struct {
 	Themes        []Theme  `json:"themes"`
 	KeyInsights   []string `json:"key_insights"`
 	Quotes        []Quote  `json:"quotes"`
 	ActionItems   []string `json:"action_items"`
 	RawIssueCount int      `json:"raw_issue_count"`
+
+	Classifications []IssueClassification `json:"classifications,omitempty"`
+	Verification    Verification          `json:"verification"`
+	Usage           []StageUsage          `json:"usage"` // LLM calls per stage, in the order stages ran
+}
+
+// Verification counts how the issue references and quotes written by the
+// model held up against the fetched issues.
+type Verification struct {
+	CitedIssues    int `json:"cited_issues"`
+	RejectedIssues int `json:"rejected_issues"` // not among the issues the model was shown
+	Quotes         int `json:"quotes"`
+	VerifiedQuotes int `json:"verified_quotes"`
+	DroppedQuotes  int `json:"dropped_quotes"`
+}
+
+func (v *Verification) add(other Verification) {
+	v.CitedIssues += other.CitedIssues
+	v.RejectedIssues += other.RejectedIssues
+	v.Quotes += other.Quotes
+	v.VerifiedQuotes += other.VerifiedQuotes
+	v.DroppedQuotes += other.DroppedQuotes
 }
 
 type Theme struct {
-	Name        string   `json:"name"`
-	Description string   `json:"description"`
-	IssueCount  int      `json:"issue_count"`
-	Severity    string   `json:"severity"` // high, medium, low
-	IssueURLs   []string `json:"issue_urls"`
-	Examples    []string `json:"examples"`
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	IssueCount  int               `json:"issue_count"`
+	Severity    string            `json:"severity"` // high, medium, low
+	Issues      []github.IssueRef `json:"issues"`
+	IssueURLs   []string          `json:"issue_urls"`
+	Examples    []string          `json:"examples"`
 }
 
 type Quote struct {
-	Text     string `json:"text"`
-	Source   string `json:"source"`
-	IssueURL string `json:"issue_url"`
+	Text     string           `json:"text"`
+	Source   string           `json:"source"`
+	Issue    *github.IssueRef `json:"issue,omitempty"`
+	IssueURL string           `json:"issue_url"`
+	Verified bool             `json:"verified"` // text was found in the cited issue
 }
 
-func New(llmClient *llm.Client) *Analyzer {
-	return &Analyzer{llm: llmClient}
+const (
+	defaultContextWindow = 4096
+	batchMaxTokens       = 1000
+	synthesisMaxTokens   = 1500
+	promptOverheadTokens = 400 // system prompt, instructions and chat template
+	minPromptBudget      = 512
+	maxCommentExcerpts   = 5
+	commentExcerptTokens = 60
+)
+
+func New(provider llm.Provider) *Analyzer {
+	return &Analyzer{llm: provider}
 }
 
 func (a *Analyzer) AnalyzeIssues(ctx context.Context, issues []github.Issue, opts Options) (*Analysis, error) {
-	// Process in batches to avoid overwhelming the LLM context
-	batchSize := 20
-	var batchAnalyses []string
-
-	for i := 0; i < len(issues); i += batchSize {
-		end := i + batchSize
-		if end > len(issues) {
-			end = len(issues)
-		}
-
-		batch := issues[i:end]
-		fmt.Printf("  Analyzing batch %d-%d of %d issues...\n", i+1, end, len(issues))
+	opts.usage = newUsageTracker()
 
-		batchAnalysis, err := a.analyzeBatch(ctx, batch, opts)
+	var classifications []IssueClassification
+	if opts.Classify {
+		fmt.Println("  Classifying issues individually...")
+		var err error
+		classifications, err = a.ClassifyIssues(ctx, issues, opts)
 		if err != nil {
-			fmt.Printf("  Warning: batch analysis failed: %v\n", err)
-			continue
+			return nil, fmt.Errorf("classify issues: %w", err)
 		}
-		batchAnalyses = append(batchAnalyses, batchAnalysis)
 	}
 
-	// Synthesize all batch analyses into final themes
-	fmt.Println("  Synthesizing themes across all batches...")
-	return a.synthesizeAnalyses(ctx, batchAnalyses, issues, opts)
-}
-
-func (a *Analyzer) analyzeBatch(ctx context.Context, issues []github.Issue, opts Options) (string, error) {
-	// Build issue summaries for the prompt
-	var issueSummaries strings.Builder
-	for _, issue := range issues {
-		body := issue.Body
-		if len(body) > 500 {
-			body = body[:500] + "..."
-		}
-		// Clean up markdown and newlines for cleaner prompt
-		body = strings.ReplaceAll(body, "\r\n", " ")
-		body = strings.ReplaceAll(body, "\n", " ")
-
-		labels := make([]string, len(issue.Labels))
-		for i, l := range issue.Labels {
-			labels[i] = l.Name
+	if opts.Strategy == StrategyCluster {
+		analysis, err := a.analyzeClusters(ctx, issues, classifications, opts)
+		if err != nil {
+			return nil, err
 		}
-
-		fmt.Fprintf(&issueSummaries, "---\nIssue #%d [%s]: %s\nLabels: %s\nComments: %d\nBody: %s\nURL: %s\n",
-			issue.Number, issue.State, issue.Title,
-			strings.Join(labels, ", "),
-			issue.Comments,
-			body,
-			issue.HTMLURL)
+		analysis.Classifications = classifications
+		analysis.Usage = opts.usage.snapshot()
+		return analysis, nil
 	}
 
-	systemPrompt := `You are an expert software analyst. Analyze GitHub issues to identify recurring themes and pain points.
-
-IMPORTANT: Respond with ONLY valid JSON, no markdown, no explanations. Keep responses concise.
-
-Required JSON structure:
-{"themes":[{"name":"string","description":"string","issue_numbers":[1,2],"severity":"high|medium|low","example_quotes":["quote"]}],"notable_quotes":[{"text":"quote","issue_number":1}]}`
-
-	focusAreas := strings.Join(opts.FocusAreas, ", ")
-	userPrompt := fmt.Sprintf(`Analyze these issues for themes about: %s
-
-%s
+	// Process in batches sized to the prompt budget
+	batches := packBatches(issues, opts)
 
-Respond with JSON only. Identify 3-5 themes with severity ratings.`, focusAreas, issueSummaries.String())
+	results := make([]*rawAnalysis, len(batches))
+	err := parallel(ctx, len(batches), opts.Concurrency, func(ctx context.Context, i int) error {
+		start := batches[i].start
+		fmt.Printf("  Analyzing batch %d-%d of %d issues...\n", start+1, start+len(batches[i].issues), len(issues))
 
-	response, err := a.llm.Complete(ctx, systemPrompt, userPrompt, 1000)
+		batchAnalysis, err := a.analyzeBatch(ctx, batches[i], opts)
+		if errors.Is(err, llm.ErrCircuitOpen) {
+			return fmt.Errorf("aborting batch analysis: %w", err)
+		}
+		if err != nil {
+			fmt.Printf("  Warning: batch analysis failed: %v\n", err)
+			return nil
+		}
+		results[i] = batchAnalysis
+		return nil
+	})
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return response, nil
-}
-
-func (a *Analyzer) synthesizeAnalyses(ctx context.Context, batchAnalyses []string, issues []github.Issue, opts Options) (*Analysis, error) {
-	// Build issue URL lookup
-	issueURLs := make(map[int]string)
-	for _, issue := range issues {
-		issueURLs[issue.Number] = issue.HTMLURL
+	var batchAnalyses []*rawAnalysis
+	for _, result := range results {
+		if result != nil {
+			batchAnalyses = append(batchAnalyses, result)
+		}
 	}
 
-	if len(batchAnalyses) == 0 {
-		return &Analysis{RawIssueCount: len(issues)}, nil
+	// Synthesize all batch analyses into final themes
+	fmt.Println("  Synthesizing themes across all batches...")
+	analysis, err := a.synthesizeAnalyses(ctx, batchAnalyses, issues, classifications, opts)
+	if err != nil {
+		return nil, err
 	}
 
-	// If only one batch, parse it directly
-	if len(batchAnalyses) == 1 {
-		return a.parseAnalysis(batchAnalyses[0], issueURLs, len(issues))
-	}
+	analysis.Classifications = classifications
+	analysis.Usage = opts.usage.snapshot()
+	return analysis, nil
+}
 
-	// Otherwise, ask LLM to synthesize
-	systemPrompt := `You synthesize multiple issue analyses into a final report. Merge similar themes, rank by importance.
+func (a *Analyzer) analyzeBatch(ctx context.Context, b batch, opts Options) (*rawAnalysis, error) {
+	systemPrompt := `You are an expert software analyst. Analyze GitHub issues to identify recurring themes and pain points.
 
-IMPORTANT: Respond with ONLY valid JSON. No markdown, no explanations. Be concise.
+IMPORTANT: Respond with ONLY valid JSON, no markdown, no explanations. Keep responses concise.
 
 Required JSON structure:
-{"themes":[{"name":"string","description":"string","issue_count":10,"severity":"high|medium|low","examples":["quote1","quote2"]}],"key_insights":["insight1"],"action_items":["action1"]}`
-
-	var analysesText strings.Builder
-	for i, analysis := range batchAnalyses {
-		fmt.Fprintf(&analysesText, "Batch %d:\n%s\n", i+1, analysis)
+{"themes":[{"name":"string","description":"string","issues":["owner/repo#1","owner/repo#2"],"severity":"high|medium|low","example_quotes":["quote"]}],"notable_quotes":[{"text":"quote","issue":"owner/repo#1"}]}`
+	if opts.Prompts.Batch != "" {
+		systemPrompt = opts.Prompts.Batch
 	}
 
-	userPrompt := fmt.Sprintf(`Synthesize these analyses about %s into 5-7 final themes:
+	focusAreas := strings.Join(opts.FocusAreas, ", ")
+	userPrompt := fmt.Sprintf(`Analyze these issues for themes about: %s
 
 %s
 
-Respond with JSON only.`, strings.Join(opts.FocusAreas, ", "), analysesText.String())
+Respond with JSON only. Identify 3-5 themes with severity ratings.`, focusAreas, b.text)
 
-	response, err := a.llm.Complete(ctx, systemPrompt, userPrompt, 1500)
-	if err != nil {
-		return nil, fmt.Errorf("synthesis failed: %w", err)
+	var raw rawAnalysis
+	if err := a.completeJSON(ctx, stageBatch, systemPrompt, userPrompt, llm.CallOptions{
+		MaxTokens:  batchMaxTokens,
+		Schema:     batchSchema,
+		Sampling:   opts.BatchSampling,
+		OnProgress: streamProgress(fmt.Sprintf("Batch %d-%d", b.start+1, b.start+len(b.issues))),
+	}, opts, &raw); err != nil {
+		return nil, err
 	}
 
-	return a.parseAnalysis(response, issueURLs, len(issues))
+	resolveRefs(&raw, b.issues)
+	verifyQuotes(&raw, newQuoteVerifier(b.issues), opts.DropUnverifiedQuotes, nil)
+	return &raw, nil
 }
 
-func (a *Analyzer) parseAnalysis(response string, issueURLs map[int]string, issueCount int) (*Analysis, error) {
-	// Extract JSON from response (it might have markdown code blocks)
-	jsonStr := response
-	if idx := strings.Index(response, "```json"); idx != -1 {
-		jsonStr = response[idx+7:]
-		if endIdx := strings.Index(jsonStr, "```"); endIdx != -1 {
-			jsonStr = jsonStr[:endIdx]
-		}
-	} else if idx := strings.Index(response, "```"); idx != -1 {
-		jsonStr = response[idx+3:]
-		if endIdx := strings.Index(jsonStr, "```"); endIdx != -1 {
-			jsonStr = jsonStr[:endIdx]
-		}
-	}
-	jsonStr = strings.TrimSpace(jsonStr)
-
-	// Try to parse the JSON
-	var rawAnalysis struct {
-		Themes []struct {
-			Name          string   `json:"name"`
-			Description   string   `json:"description"`
-			IssueNumbers  []int    `json:"issue_numbers"`
-			IssueCount    int      `json:"issue_count"`
-			Severity      string   `json:"severity"`
-			Examples      []string `json:"examples"`
-			ExampleQuotes []string `json:"example_quotes"`
-		} `json:"themes"`
-		KeyInsights   []string `json:"key_insights"`
-		NotableQuotes []struct {
-			Text        string `json:"text"`
-			IssueNumber int    `json:"issue_number"`
-		} `json:"notable_quotes"`
-		ActionItems []string `json:"action_items"`
-	}
-
-	if err := json.Unmarshal([]byte(jsonStr), &rawAnalysis); err != nil {
-		// If JSON parsing fails, create a basic analysis with the raw response
-		return &Analysis{
-			Themes: []Theme{{
-				Name:        "Raw Analysis",
-				Description: response,
-				IssueCount:  issueCount,
-				Severity:    "medium",
-			}},
-			RawIssueCount: issueCount,
-		}, nil
+// formatIssue renders an issue for inclusion in a prompt, truncating the
+// body so the result stays within roughly maxTokens.
+func formatIssue(issue github.Issue, maxTokens int) string {
+	labels := make([]string, len(issue.Labels))
+	for i, l := range issue.Labels {
+		labels[i] = l.Name
 	}
 
-	// Convert to our Analysis struct
-	analysis := &Analysis{
-		RawIssueCount: issueCount,
-		KeyInsights:   rawAnalysis.KeyInsights,
-		ActionItems:   rawAnalysis.ActionItems,
+	header := fmt.Sprintf("---\nIssue %s [%s]: %s\nLabels: %s\nComments: %d\nURL: %s\n",
+		issue.Ref(), issue.State, issue.Title,
+		strings.Join(labels, ", "),
+		issue.Comments,
+		issue.HTMLURL)
+	thread := formatThread(issue.Thread)
+
+	// The discussion only gets the room the header and body leave over
+	bodyBudget := maxTokens - llm.EstimateTokens(header) - llm.EstimateTokens(thread)
+	if bodyBudget < minBodyTokens {
+		thread = ""
+		bodyBudget = max(maxTokens-llm.EstimateTokens(header), minBodyTokens)
 	}
 
-	for _, t := range rawAnalysis.Themes {
-		theme := Theme{
-			Name:        t.Name,
-			Description: t.Description,
-			Severity:    t.Severity,
-			IssueCount:  t.IssueCount,
-		}
-
-		// Use issue_numbers if issue_count not set
-		if theme.IssueCount == 0 && len(t.IssueNumbers) > 0 {
-			theme.IssueCount = len(t.IssueNumbers)
-		}
-
-		// Map issue numbers to URLs
-		for _, num := range t.IssueNumbers {
-			if url, ok := issueURLs[num]; ok {
-				theme.IssueURLs = append(theme.IssueURLs, url)
-			}
-		}
+	// Strip template noise and logs, then flatten newlines for a cleaner prompt
+	body := strings.Join(strings.Fields(cleanBody(issue.Body)), " ")
+	body = truncateTokens(body, bodyBudget)
 
-		// Combine examples
-		theme.Examples = append(theme.Examples, t.Examples...)
-		theme.Examples = append(theme.Examples, t.ExampleQuotes...)
+	return header + "Body: " + body + "\n" + thread
+}
 
-		analysis.Themes = append(analysis.Themes, theme)
+// formatThread condenses fetched comments into short excerpts so themes
+// reflect workarounds and "me too" reports from the discussion.
+func formatThread(thread []github.Comment) string {
+	if len(thread) == 0 {
+		return ""
 	}
 
-	// Convert notable quotes
-	for _, q := range rawAnalysis.NotableQuotes {
-		quote := Quote{
-			Text: q.Text,
+	var sb strings.Builder
+	sb.WriteString("Discussion:\n")
+	for i, comment := range thread {
+		if i >= maxCommentExcerpts {
+			fmt.Fprintf(&sb, "(%d more comments)\n", len(thread)-i)
+			break
 		}
-		if url, ok := issueURLs[q.IssueNumber]; ok {
-			quote.IssueURL = url
-			quote.Source = fmt.Sprintf("Issue #%d", q.IssueNumber)
-		}
-		analysis.Quotes = append(analysis.Quotes, quote)
-	}
 
-	return analysis, nil
+		text := strings.Join(strings.Fields(cleanBody(comment.Body)), " ")
+		text = truncateTokens(text, commentExcerptTokens)
+		fmt.Fprintf(&sb, "- @%s: %s\n", comment.User.Login, text)
+	}
+	return sb.String()
 }
@@ -0,0 +1,93 @@
+package analyzer
+
+import (
+	"strings"
+
+	"github.com/defilan/issueparser/internal/github"
+	"github.com/defilan/issueparser/internal/llm"
+)
+
+const (
+	defaultMaxBatchIssues = 20
+	minIssuesPerBatch     = 8 // long issues are truncated so at least this many fit
+	minIssueTokens        = 96
+	minBodyTokens         = 32
+)
+
+// batch is a group of issues packed to fit the batch prompt budget, along
+// with the rendered issue text.
+type batch struct {
+	issues []github.Issue
+	text   string
+	start  int // index of the first issue in the full issue list
+}
+
+// packBatches groups issues greedily so each batch prompt fits the token
+// budget left after the system prompt and the batch response. Issues longer
+// than the per-issue cap are truncated rather than split across batches.
+func packBatches(issues []github.Issue, opts Options) []batch {
+	budget := promptBudget(opts, batchMaxTokens)
+	issueCap := issueTokenCap(opts, budget)
+	maxIssues := opts.MaxBatchIssues
+	if maxIssues <= 0 {
+		maxIssues = defaultMaxBatchIssues
+	}
+
+	var batches []batch
+	var current batch
+	var text strings.Builder
+	used := 0
+
+	for i, issue := range issues {
+		rendered := formatIssue(issue, issueCap)
+		tokens := llm.EstimateTokens(rendered)
+
+		if len(current.issues) > 0 && (used+tokens > budget || len(current.issues) >= maxIssues) {
+			current.text = text.String()
+			batches = append(batches, current)
+			current = batch{}
+			text.Reset()
+			used = 0
+		}
+
+		if len(current.issues) == 0 {
+			current.start = i
+		}
+		current.issues = append(current.issues, issue)
+		text.WriteString(rendered)
+		used += tokens
+	}
+
+	if len(current.issues) > 0 {
+		current.text = text.String()
+		batches = append(batches, current)
+	}
+
+	return batches
+}
+
+// promptBudget returns the tokens available for the variable part of a
+// prompt (issues or analyses) when the response may use up to maxTokens.
+func promptBudget(opts Options, maxTokens int) int {
+	window := opts.ContextWindow
+	if window <= 0 {
+		window = defaultContextWindow
+	}
+
+	budget := window - maxTokens - promptOverheadTokens
+	if opts.MaxPromptTokens > 0 && opts.MaxPromptTokens-promptOverheadTokens < budget {
+		budget = opts.MaxPromptTokens - promptOverheadTokens
+	}
+	if budget < minPromptBudget {
+		budget = minPromptBudget
+	}
+	return budget
+}
+
+// issueTokenCap returns the most tokens a single rendered issue may use.
+func issueTokenCap(opts Options, budget int) int {
+	if opts.MaxIssueTokens > 0 {
+		return min(opts.MaxIssueTokens, budget)
+	}
+	return max(budget/minIssuesPerBatch, minIssueTokens)
+}
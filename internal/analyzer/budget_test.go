@@ -0,0 +1,149 @@
+package analyzer
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/defilan/issueparser/internal/github"
+	"github.com/defilan/issueparser/internal/llm"
+)
+
+func TestPromptBudget(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      Options
+		maxTokens int
+		want      int
+	}{
+		{"default window", Options{}, batchMaxTokens, 4096 - batchMaxTokens - promptOverheadTokens},
+		{"synthesis response", Options{}, synthesisMaxTokens, 4096 - synthesisMaxTokens - promptOverheadTokens},
+		{"larger window", Options{ContextWindow: 8192}, batchMaxTokens, 8192 - batchMaxTokens - promptOverheadTokens},
+		{"prompt cap below window", Options{ContextWindow: 8192, MaxPromptTokens: 1400}, batchMaxTokens, 1000},
+		{"prompt cap above window", Options{ContextWindow: 4096, MaxPromptTokens: 100000}, batchMaxTokens, 2696},
+		{"floor for small windows", Options{ContextWindow: 1024}, batchMaxTokens, minPromptBudget},
+		{"floor for small prompt caps", Options{MaxPromptTokens: 450}, batchMaxTokens, minPromptBudget},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := promptBudget(tt.opts, tt.maxTokens); got != tt.want {
+				t.Errorf("promptBudget = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIssueTokenCap(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   Options
+		budget int
+		want   int
+	}{
+		{"share of the budget", Options{}, 2696, 2696 / minIssuesPerBatch},
+		{"floor", Options{}, minPromptBudget, minIssueTokens},
+		{"explicit cap", Options{MaxIssueTokens: 200}, 2696, 200},
+		{"explicit cap above the budget", Options{MaxIssueTokens: 5000}, 2696, 2696},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := issueTokenCap(tt.opts, tt.budget); got != tt.want {
+				t.Errorf("issueTokenCap = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// testIssues returns n issues that render to the same number of tokens.
+func testIssues(n int) []github.Issue {
+	issues := make([]github.Issue, n)
+	for i := range issues {
+		issues[i] = github.Issue{
+			Number:  100 + i,
+			Title:   "Crash when loading the model",
+			Body:    "The server crashes with an out of memory error after loading the model on two GPUs.",
+			State:   "open",
+			HTMLURL: fmt.Sprintf("https://github.com/o/r/issues/%d", 100+i),
+		}
+	}
+	return issues
+}
+
+func TestPackBatches(t *testing.T) {
+	small := testIssues(1)[0]
+	huge := small
+	huge.Number = 999
+	huge.Body = strings.Repeat("The model runs out of memory again. ", 500)
+
+	// Budget-bound batches hold as many equal-sized issues as fit
+	budgetOpts := Options{MaxPromptTokens: 912, MaxBatchIssues: 100} // 512 token budget
+	issueTokens := llm.EstimateTokens(formatIssue(small, issueTokenCap(budgetOpts, 512)))
+	perBatch := 512 / issueTokens
+
+	tests := []struct {
+		name       string
+		issues     []github.Issue
+		opts       Options
+		wantSizes  []int
+		wantStarts []int
+	}{
+		{
+			name:       "issue count limit",
+			issues:     testIssues(7),
+			opts:       Options{MaxBatchIssues: 3},
+			wantSizes:  []int{3, 3, 1},
+			wantStarts: []int{0, 3, 6},
+		},
+		{
+			name:       "default issue count limit",
+			issues:     testIssues(defaultMaxBatchIssues + 1),
+			opts:       Options{ContextWindow: 32768},
+			wantSizes:  []int{defaultMaxBatchIssues, 1},
+			wantStarts: []int{0, defaultMaxBatchIssues},
+		},
+		{
+			name:       "token budget",
+			issues:     testIssues(perBatch*2 + 1),
+			opts:       budgetOpts,
+			wantSizes:  []int{perBatch, perBatch, 1},
+			wantStarts: []int{0, perBatch, perBatch * 2},
+		},
+		{
+			name:       "oversized issue gets its own batch",
+			issues:     []github.Issue{small, huge, small},
+			opts:       Options{MaxIssueTokens: 100000},
+			wantSizes:  []int{1, 1, 1},
+			wantStarts: []int{0, 1, 2},
+		},
+		{
+			name:   "no issues",
+			issues: nil,
+			opts:   Options{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			batches := packBatches(tt.issues, tt.opts)
+
+			var sizes, starts []int
+			for _, b := range batches {
+				sizes = append(sizes, len(b.issues))
+				starts = append(starts, b.start)
+			}
+			if !reflect.DeepEqual(sizes, tt.wantSizes) || !reflect.DeepEqual(starts, tt.wantStarts) {
+				t.Errorf("batch sizes %v starting at %v, want %v starting at %v", sizes, starts, tt.wantSizes, tt.wantStarts)
+			}
+
+			budget := promptBudget(tt.opts, batchMaxTokens)
+			for i, b := range batches {
+				if tokens := llm.EstimateTokens(b.text); tokens > budget {
+					t.Errorf("batch %d uses %d tokens, over the budget of %d", i, tokens, budget)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package analyzer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/defilan/issueparser/internal/github"
+	"github.com/defilan/issueparser/internal/llm"
+)
+
+const (
+	classifyMaxTokens   = 200
+	classifyIssueTokens = 1024 // enough to classify; keeps per-issue prefill short
+)
+
+// IssueClassification is the model's assessment of a single issue.
+type IssueClassification struct {
+	Issue     github.IssueRef `json:"issue"`
+	Title     string          `json:"title"`
+	URL       string          `json:"url"`
+	Kind      string          `json:"kind"` // bug, feature, question, other
+	Category  string          `json:"category"`
+	Severity  string          `json:"severity"` // high, medium, low
+	Component string          `json:"component"`
+	Summary   string          `json:"summary"`
+}
+
+// ClassifyIssues asks the LLM to classify each issue individually. Issues
+// whose classification fails are skipped with a warning.
+func (a *Analyzer) ClassifyIssues(ctx context.Context, issues []github.Issue, opts Options) ([]IssueClassification, error) {
+	results := make([]*IssueClassification, len(issues))
+	err := parallel(ctx, len(issues), opts.Concurrency, func(ctx context.Context, i int) error {
+		issue := issues[i]
+		fmt.Printf("  Classifying issue %d of %d (%s)...\n", i+1, len(issues), issue.Ref())
+
+		classification, err := a.classifyIssue(ctx, issue, opts)
+		if errors.Is(err, llm.ErrCircuitOpen) {
+			return fmt.Errorf("aborting classification: %w", err)
+		}
+		if err != nil {
+			fmt.Printf("  Warning: classification of %s failed: %v\n", issue.Ref(), err)
+			return nil
+		}
+		results[i] = classification
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var classifications []IssueClassification
+	for _, result := range results {
+		if result != nil {
+			classifications = append(classifications, *result)
+		}
+	}
+
+	return classifications, nil
+}
+
+func (a *Analyzer) classifyIssue(ctx context.Context, issue github.Issue, opts Options) (*IssueClassification, error) {
+	categories := append(append([]string{}, opts.FocusAreas...), "other")
+
+	systemPrompt := `You are an expert software analyst. Classify a single GitHub issue.
+
+IMPORTANT: Respond with ONLY valid JSON, no markdown, no explanations.
+
+Required JSON structure:
+{"kind":"bug|feature|question|other","category":"string","severity":"high|medium|low","component":"string","summary":"one sentence"}`
+	if opts.Prompts.Classify != "" {
+		systemPrompt = opts.Prompts.Classify
+	}
+
+	userPrompt := fmt.Sprintf(`Classify this issue. Pick the category from: %s.
+The component is the affected part of the software in 1-3 words.
+
+%s
+Respond with JSON only.`, strings.Join(categories, ", "), formatIssue(issue, min(promptBudget(opts, classifyMaxTokens), classifyIssueTokens)))
+
+	var raw struct {
+		Kind      string `json:"kind"`
+		Category  string `json:"category"`
+		Severity  string `json:"severity"`
+		Component string `json:"component"`
+		Summary   string `json:"summary"`
+	}
+	if err := a.completeJSON(ctx, stageClassify, systemPrompt, userPrompt, llm.CallOptions{
+		MaxTokens: classifyMaxTokens,
+		Schema:    classifySchema,
+		Sampling:  opts.BatchSampling,
+	}, opts, &raw); err != nil {
+		return nil, fmt.Errorf("classification: %w", err)
+	}
+
+	return &IssueClassification{
+		Issue:     issue.Ref(),
+		Title:     issue.Title,
+		URL:       issue.HTMLURL,
+		Kind:      oneOf(raw.Kind, "other", "bug", "feature", "question"),
+		Category:  strings.TrimSpace(raw.Category),
+		Severity:  oneOf(raw.Severity, "medium", "high", "medium", "low"),
+		Component: strings.TrimSpace(raw.Component),
+		Summary:   strings.TrimSpace(raw.Summary),
+	}, nil
+}
+
+// oneOf normalizes value to one of the allowed values, or returns fallback.
+func oneOf(value, fallback string, allowed ...string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	for _, v := range allowed {
+		if value == v {
+			return v
+		}
+	}
+	return fallback
+}
+
+// classificationCounts renders per-kind and per-category counts for use as
+// ground truth in the synthesis prompt.
+func classificationCounts(classifications []IssueClassification) string {
+	kinds := make(map[string]int)
+	categories := make(map[string]int)
+	for _, c := range classifications {
+		kinds[c.Kind]++
+		categories[c.Category]++
+	}
+	return fmt.Sprintf("Kinds: %s\nCategories: %s", formatCounts(kinds), formatCounts(categories))
+}
+
+func formatCounts(counts map[string]int) string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s %d", k, counts[k])
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,329 @@
+package analyzer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/defilan/issueparser/internal/github"
+	"github.com/defilan/issueparser/internal/llm"
+)
+
+const (
+	defaultClusterThreshold = 0.75
+	defaultMinClusterSize   = 2
+	embedBatchSize          = 64
+	embedMaxTokens          = 512
+	clusterSampleSize       = 10 // issues shown to the LLM when naming a cluster
+)
+
+// analyzeClusters groups issues by embedding similarity and only asks the
+// LLM to name and describe each group. Theme membership and counts come from
+// the clustering, not from the model.
+func (a *Analyzer) analyzeClusters(ctx context.Context, issues []github.Issue, classifications []IssueClassification, opts Options) (*Analysis, error) {
+	fmt.Printf("  Embedding %d issues...\n", len(issues))
+	vectors, err := a.embedIssues(ctx, issues, opts)
+	if err != nil {
+		return nil, fmt.Errorf("embed issues: %w", err)
+	}
+
+	threshold := opts.ClusterThreshold
+	if threshold <= 0 {
+		threshold = defaultClusterThreshold
+	}
+	minSize := opts.MinClusterSize
+	if minSize <= 0 {
+		minSize = defaultMinClusterSize
+	}
+
+	clusters, unclustered := dropSmallClusters(clusterVectors(vectors, threshold), minSize)
+	fmt.Printf("  Found %d clusters (%d issues in smaller groups were left out)\n", len(clusters), unclustered)
+
+	themes := make([]rawTheme, len(clusters))
+	stats := make([]Verification, len(clusters))
+	err = parallel(ctx, len(clusters), opts.Concurrency, func(ctx context.Context, i int) error {
+		members := make([]github.Issue, len(clusters[i]))
+		for j, idx := range clusters[i] {
+			members[j] = issues[idx]
+		}
+
+		fmt.Printf("  Naming cluster %d of %d (%d issues)...\n", i+1, len(clusters), len(members))
+		theme, err := a.nameCluster(ctx, members, fmt.Sprintf("Cluster %d", i+1), opts)
+		if errors.Is(err, llm.ErrCircuitOpen) {
+			return fmt.Errorf("aborting cluster naming: %w", err)
+		}
+		if err != nil {
+			fmt.Printf("  Warning: naming cluster %d failed: %v\n", i+1, err)
+			theme = &rawTheme{Name: fmt.Sprintf("Cluster %d", i+1), Description: members[0].Title, Severity: "medium"}
+		}
+
+		theme.Refs = make([]github.IssueRef, len(members))
+		for j, issue := range members {
+			theme.Refs[j] = issue.Ref()
+		}
+		theme.IssueCount = len(members)
+
+		named := &rawAnalysis{Themes: []rawTheme{*theme}}
+		verifyQuotes(named, newQuoteVerifier(members), opts.DropUnverifiedQuotes, nil)
+		themes[i] = named.Themes[0]
+		stats[i] = named.verification
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	raw := &rawAnalysis{Themes: themes}
+	for _, s := range stats {
+		raw.verification.add(s)
+	}
+	if len(raw.Themes) > 0 {
+		fmt.Println("  Summarizing clusters...")
+		if err := a.summarizeClusters(ctx, raw, classifications, opts); err != nil {
+			fmt.Printf("  Warning: cluster summary failed: %v\n", err)
+		}
+	}
+
+	issueURLs := make(map[github.IssueRef]string)
+	for _, issue := range issues {
+		issueURLs[issue.Ref()] = issue.HTMLURL
+	}
+
+	return buildAnalysis(raw, issueURLs, len(issues)), nil
+}
+
+func (a *Analyzer) embedIssues(ctx context.Context, issues []github.Issue, opts Options) ([][]float64, error) {
+	embedder, ok := a.llm.(llm.Embedder)
+	if !ok {
+		return nil, fmt.Errorf("LLM provider does not support embeddings")
+	}
+
+	vectors := make([][]float64, 0, len(issues))
+
+	for i := 0; i < len(issues); i += embedBatchSize {
+		end := i + embedBatchSize
+		if end > len(issues) {
+			end = len(issues)
+		}
+
+		inputs := make([]string, 0, end-i)
+		for _, issue := range issues[i:end] {
+			text := issue.Title + "\n" + truncateTokens(cleanBody(issue.Body), embedMaxTokens)
+			inputs = append(inputs, text)
+		}
+
+		batch, err := embedder.Embed(ctx, opts.EmbeddingModel, inputs)
+		if err != nil {
+			return nil, err
+		}
+		vectors = append(vectors, batch...)
+	}
+
+	return vectors, nil
+}
+
+func (a *Analyzer) nameCluster(ctx context.Context, members []github.Issue, label string, opts Options) (*rawTheme, error) {
+	sample := members
+	if len(sample) > clusterSampleSize {
+		sample = sample[:clusterSampleSize]
+	}
+
+	budget := promptBudget(opts, batchMaxTokens)
+	issueCap := issueTokenCap(opts, budget)
+
+	var issueSummaries strings.Builder
+	used := 0
+	for i, issue := range sample {
+		rendered := formatIssue(issue, issueCap)
+		tokens := llm.EstimateTokens(rendered)
+		if i > 0 && used+tokens > budget {
+			sample = sample[:i]
+			break
+		}
+		issueSummaries.WriteString(rendered)
+		used += tokens
+	}
+
+	systemPrompt := `You are an expert software analyst. The GitHub issues below were grouped together because they are similar. Name the common theme.
+
+IMPORTANT: Respond with ONLY valid JSON, no markdown, no explanations. Keep responses concise.
+
+Required JSON structure:
+{"name":"string","description":"string","severity":"high|medium|low","example_quotes":["quote"]}`
+	if opts.Prompts.ClusterNaming != "" {
+		systemPrompt = opts.Prompts.ClusterNaming
+	}
+
+	userPrompt := fmt.Sprintf(`These %d issues (showing %d) relate to: %s
+
+%s
+
+Respond with JSON only.`, len(members), len(sample), strings.Join(opts.FocusAreas, ", "), issueSummaries.String())
+
+	var theme rawTheme
+	if err := a.completeJSON(ctx, stageClusterNaming, systemPrompt, userPrompt, llm.CallOptions{
+		MaxTokens:  batchMaxTokens,
+		Schema:     clusterThemeSchema,
+		Sampling:   opts.BatchSampling,
+		OnProgress: streamProgress(label),
+	}, opts, &theme); err != nil {
+		return nil, fmt.Errorf("cluster theme: %w", err)
+	}
+	return &theme, nil
+}
+
+// summarizeClusters asks the LLM for key insights and action items across
+// the named clusters.
+func (a *Analyzer) summarizeClusters(ctx context.Context, raw *rawAnalysis, classifications []IssueClassification, opts Options) error {
+	systemPrompt := `You summarize issue themes into a final report.
+
+IMPORTANT: Respond with ONLY valid JSON. No markdown, no explanations. Be concise.
+
+Required JSON structure:
+{"key_insights":["insight1"],"action_items":["action1"]}`
+	if opts.Prompts.ClusterSummary != "" {
+		systemPrompt = opts.Prompts.ClusterSummary
+	}
+
+	var groundTruth string
+	if len(classifications) > 0 {
+		groundTruth = fmt.Sprintf("Per-issue classification counts (ground truth, %d issues):\n%s\n\n",
+			len(classifications), classificationCounts(classifications))
+	}
+
+	userPrompt := fmt.Sprintf(`Summarize these themes about %s:
+
+%s%s
+
+Respond with JSON only.`, strings.Join(opts.FocusAreas, ", "), groundTruth, formatAnalyses([]*rawAnalysis{raw}))
+
+	var summary rawAnalysis
+	if err := a.completeJSON(ctx, stageClusterSummary, systemPrompt, userPrompt, llm.CallOptions{
+		MaxTokens:  synthesisMaxTokens,
+		Schema:     clusterSummarySchema,
+		Sampling:   opts.SynthesisSampling,
+		OnProgress: streamProgress("Cluster summary"),
+	}, opts, &summary); err != nil {
+		return err
+	}
+
+	raw.KeyInsights = summary.KeyInsights
+	raw.ActionItems = summary.ActionItems
+	return nil
+}
+
+// clusterVectors performs average-linkage agglomerative clustering on cosine
+// similarity, merging clusters until no pair is at least threshold similar.
+// Clusters are returned largest first, each as a list of vector indexes.
+func clusterVectors(vectors [][]float64, threshold float64) [][]int {
+	n := len(vectors)
+	sim := make([][]float64, n)
+	for i := range sim {
+		sim[i] = make([]float64, n)
+	}
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			s := cosine(vectors[i], vectors[j])
+			sim[i][j], sim[j][i] = s, s
+		}
+	}
+
+	members := make([][]int, n)
+	active := make([]bool, n)
+	for i := range members {
+		members[i] = []int{i}
+		active[i] = true
+	}
+
+	// best[i] caches the most similar active cluster to i
+	best := make([]int, n)
+	bestRow := func(i int) {
+		best[i] = -1
+		for j := 0; j < n; j++ {
+			if j != i && active[j] && (best[i] == -1 || sim[i][j] > sim[i][best[i]]) {
+				best[i] = j
+			}
+		}
+	}
+	for i := 0; i < n; i++ {
+		bestRow(i)
+	}
+
+	for {
+		a := -1
+		for i := 0; i < n; i++ {
+			if active[i] && best[i] != -1 && (a == -1 || sim[i][best[i]] > sim[a][best[a]]) {
+				a = i
+			}
+		}
+		if a == -1 || sim[a][best[a]] < threshold {
+			break
+		}
+
+		// Merge b into a, updating similarities with the Lance-Williams
+		// formula for average linkage
+		b := best[a]
+		na, nb := float64(len(members[a])), float64(len(members[b]))
+		for k := 0; k < n; k++ {
+			if active[k] && k != a && k != b {
+				s := (na*sim[a][k] + nb*sim[b][k]) / (na + nb)
+				sim[a][k], sim[k][a] = s, s
+			}
+		}
+		members[a] = append(members[a], members[b]...)
+		members[b] = nil
+		active[b] = false
+
+		for k := 0; k < n; k++ {
+			if !active[k] {
+				continue
+			}
+			if k == a || best[k] == a || best[k] == b {
+				bestRow(k)
+			} else if sim[k][a] > sim[k][best[k]] {
+				best[k] = a
+			}
+		}
+	}
+
+	var clusters [][]int
+	for i := 0; i < n; i++ {
+		if active[i] {
+			sort.Ints(members[i])
+			clusters = append(clusters, members[i])
+		}
+	}
+	sort.SliceStable(clusters, func(i, j int) bool {
+		return len(clusters[i]) > len(clusters[j])
+	})
+	return clusters
+}
+
+// dropSmallClusters keeps the clusters with at least minSize members and
+// counts the members of the others.
+func dropSmallClusters(clusters [][]int, minSize int) (kept [][]int, dropped int) {
+	for _, cluster := range clusters {
+		if len(cluster) < minSize {
+			dropped += len(cluster)
+			continue
+		}
+		kept = append(kept, cluster)
+	}
+	return kept, dropped
+}
+
+func cosine(a, b []float64) float64 {
+	var dot, na, nb float64
+	for i := 0; i < len(a) && i < len(b); i++ {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
@@ -0,0 +1,187 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/defilan/issueparser/internal/github"
+	"github.com/defilan/issueparser/internal/llm"
+)
+
+// Two tight groups and an outlier: 0-2 point along x, 3-4 along y and 5
+// along z.
+var testVectors = [][]float64{
+	{1, 0, 0},
+	{0.9, 0.1, 0},
+	{0.95, 0, 0.05},
+	{0, 1, 0},
+	{0, 0.9, 0.1},
+	{0, 0, 1},
+}
+
+func TestClusterVectors(t *testing.T) {
+	tests := []struct {
+		name        string
+		vectors     [][]float64
+		threshold   float64
+		minSize     int
+		want        [][]int
+		wantDropped int
+	}{
+		{
+			name:        "groups and outlier",
+			vectors:     testVectors,
+			threshold:   0.75,
+			minSize:     2,
+			want:        [][]int{{0, 1, 2}, {3, 4}},
+			wantDropped: 1,
+		},
+		{
+			name:        "min size drops smaller groups",
+			vectors:     testVectors,
+			threshold:   0.75,
+			minSize:     3,
+			want:        [][]int{{0, 1, 2}},
+			wantDropped: 3,
+		},
+		{
+			name:      "threshold above every similarity",
+			vectors:   testVectors,
+			threshold: 0.999,
+			minSize:   1,
+			want:      [][]int{{0}, {1}, {2}, {3}, {4}, {5}},
+		},
+		{
+			name:      "threshold below every similarity",
+			vectors:   testVectors,
+			threshold: -1,
+			minSize:   2,
+			want:      [][]int{{0, 1, 2, 3, 4, 5}},
+		},
+		{
+			name:        "zero vector is similar to nothing",
+			vectors:     [][]float64{{1, 0}, {1, 0.01}, {0, 0}},
+			threshold:   0.5,
+			minSize:     2,
+			want:        [][]int{{0, 1}},
+			wantDropped: 1,
+		},
+		{
+			name:      "no vectors",
+			threshold: 0.75,
+			minSize:   2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, dropped := dropSmallClusters(clusterVectors(tt.vectors, tt.threshold), tt.minSize)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("clusters = %v, want %v", got, tt.want)
+			}
+			if dropped != tt.wantDropped {
+				t.Errorf("dropped = %d, want %d", dropped, tt.wantDropped)
+			}
+		})
+	}
+}
+
+func TestCosine(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []float64
+		want float64
+	}{
+		{"identical", []float64{1, 2, 3}, []float64{1, 2, 3}, 1},
+		{"scaled", []float64{1, 2, 3}, []float64{2, 4, 6}, 1},
+		{"orthogonal", []float64{1, 0}, []float64{0, 1}, 0},
+		{"opposite", []float64{1, 1}, []float64{-1, -1}, -1},
+		{"zero vector", []float64{0, 0}, []float64{1, 1}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cosine(tt.a, tt.b); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("cosine(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+// embeddingServer stubs /v1/embeddings, embedding an input that starts with
+// "issue N" as the vector {N}. Responses list the inputs in reverse order, as
+// the API allows, so callers must sort by index.
+func embeddingServer(t *testing.T, requests *[]llm.EmbeddingRequest) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/embeddings" {
+			http.NotFound(w, r)
+			return
+		}
+		var req llm.EmbeddingRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		*requests = append(*requests, req)
+
+		var resp llm.EmbeddingResponse
+		for i := len(req.Input) - 1; i >= 0; i-- {
+			var n float64
+			if _, err := fmt.Sscanf(req.Input[i], "issue %g", &n); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			resp.Data = append(resp.Data, llm.Embedding{Index: i, Embedding: []float64{n}})
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestEmbedIssues(t *testing.T) {
+	var requests []llm.EmbeddingRequest
+	srv := embeddingServer(t, &requests)
+
+	issues := make([]github.Issue, embedBatchSize+6)
+	for i := range issues {
+		issues[i] = github.Issue{Number: i, Title: fmt.Sprintf("issue %d", i), Body: strings.Repeat("word ", 2000)}
+	}
+
+	a := New(llm.NewClient(srv.URL, "chat-model", llm.Options{}))
+	vectors, err := a.embedIssues(context.Background(), issues, Options{EmbeddingModel: "embed-model"})
+	if err != nil {
+		t.Fatalf("embedIssues: %v", err)
+	}
+
+	if len(vectors) != len(issues) {
+		t.Fatalf("got %d vectors for %d issues", len(vectors), len(issues))
+	}
+	for i, v := range vectors {
+		if len(v) != 1 || v[0] != float64(i) {
+			t.Errorf("vector %d = %v, want [%d]", i, v, i)
+		}
+	}
+
+	if len(requests) != 2 {
+		t.Fatalf("got %d requests, want 2 batches", len(requests))
+	}
+	for _, req := range requests {
+		if req.Model != "embed-model" {
+			t.Errorf("request model = %q, want embed-model", req.Model)
+		}
+		for _, input := range req.Input {
+			if tokens := llm.EstimateTokens(input); tokens > embedMaxTokens+20 {
+				t.Errorf("input of %d tokens was not truncated to about %d", tokens, embedMaxTokens)
+			}
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/defilan/issueparser/internal/llm"
+)
+
+const defaultMaxRepairAttempts = 2
+
+// errInvalidJSON marks responses that stayed unparseable after every repair
+// attempt, as opposed to requests that failed outright.
+var errInvalidJSON = errors.New("invalid JSON")
+
+// completeJSON sends a prompt and decodes the JSON response into v. Output
+// that is cut off by max_tokens or fails to parse even after repairJSON is
+// sent back to the model, asking it to continue or fix its JSON, up to
+// opts.MaxRepairAttempts times. Every call's usage is recorded under stage.
+func (a *Analyzer) completeJSON(ctx context.Context, stage, systemPrompt, userPrompt string, callOpts llm.CallOptions,
+	opts Options, v any) error {
+	attempts := opts.MaxRepairAttempts
+	if attempts == 0 {
+		attempts = defaultMaxRepairAttempts
+	}
+	attempts = max(attempts, 0)
+
+	base := []llm.Message{
+		{Role: "system", Content: systemPrompt},
+		{Role: "user", Content: userPrompt},
+	}
+	messages := base
+	content := ""
+	continuing := false
+
+	for attempt := 0; ; attempt++ {
+		start := time.Now()
+		resp, err := a.llm.Chat(ctx, messages, callOpts)
+		if err == nil {
+			opts.usage.record(stage, messages, resp, time.Since(start))
+		}
+		if err != nil {
+			// A continuation can overflow the context window; fall back to
+			// repairing what we already have
+			if continuing && content != "" && decodeJSON(content, v) == nil {
+				return nil
+			}
+			return err
+		}
+		if len(resp.Choices) == 0 {
+			return fmt.Errorf("no choices in response")
+		}
+
+		choice := resp.Choices[0]
+		if continuing {
+			content = joinContinuation(content, choice.Message.Content)
+		} else {
+			content = choice.Message.Content
+		}
+		truncated := choice.FinishReason == "length"
+
+		decodeErr := decodeJSON(content, v)
+		if decodeErr == nil && !truncated {
+			return nil
+		}
+		if attempt >= attempts {
+			if decodeErr == nil {
+				return nil // repaired truncated output is better than nothing
+			}
+			return fmt.Errorf("%w after %d attempts: %v", errInvalidJSON, attempt+1, decodeErr)
+		}
+
+		if truncated {
+			fmt.Println("    Response hit max_tokens, asking the model to continue...")
+			messages = append(append([]llm.Message{}, base...),
+				llm.Message{Role: "assistant", Content: content},
+				llm.Message{Role: "user", Content: "Your JSON was cut off. Continue exactly where you stopped. Do not repeat earlier output."})
+			// A schema would force the continuation to start a new document
+			callOpts.Schema = nil
+			continuing = true
+		} else {
+			fmt.Printf("    Response was not valid JSON (%v), asking the model to fix it...\n", decodeErr)
+			messages = append(append([]llm.Message{}, base...),
+				llm.Message{Role: "assistant", Content: content},
+				llm.Message{Role: "user", Content: fmt.Sprintf(
+					"That is not valid JSON (%v). Respond again with only the corrected JSON, no markdown.", decodeErr)})
+			continuing = false
+		}
+	}
+}
+
+// joinContinuation appends a continuation to truncated output. Models
+// sometimes restart from scratch instead of continuing; a continuation that
+// parses on its own is taken as a replacement. Others often repeat the end
+// of the output before going on, so when the plain join does not parse, the
+// longest overlap that gives valid JSON is removed.
+func joinContinuation(content, continuation string) string {
+	trimmed := strings.TrimSpace(extractJSON(continuation))
+	if strings.HasPrefix(trimmed, "{") && json.Valid([]byte(trimmed)) {
+		return trimmed
+	}
+
+	joined := content + continuation
+	if json.Valid([]byte(extractJSON(joined))) {
+		return joined
+	}
+	for k := min(len(content), len(continuation)); k > 0; k-- {
+		if !strings.HasSuffix(content, continuation[:k]) {
+			continue
+		}
+		if candidate := content + continuation[k:]; json.Valid([]byte(extractJSON(candidate))) {
+			return candidate
+		}
+	}
+	return joined
+}
+
+// decodeJSON unmarshals the JSON in an LLM response into v, repairing common
+// defects when the response does not parse as-is.
+func decodeJSON(response string, v any) error {
+	jsonStr := extractJSON(response)
+	err := json.Unmarshal([]byte(jsonStr), v)
+	if err == nil {
+		return nil
+	}
+
+	// Type errors mean the JSON itself was fine
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return err
+	}
+
+	if repairErr := json.Unmarshal([]byte(repairJSON(jsonStr)), v); repairErr != nil {
+		return err
+	}
+	return nil
+}
+
+// extractJSON strips markdown code fences and any prose the model wrapped
+// around its JSON.
+func extractJSON(response string) string {
+	jsonStr := response
+	if idx := strings.Index(response, "```json"); idx != -1 {
+		jsonStr = response[idx+7:]
+		if endIdx := strings.Index(jsonStr, "```"); endIdx != -1 {
+			jsonStr = jsonStr[:endIdx]
+		}
+	} else if idx := strings.Index(response, "```"); idx != -1 {
+		jsonStr = response[idx+3:]
+		if endIdx := strings.Index(jsonStr, "```"); endIdx != -1 {
+			jsonStr = jsonStr[:endIdx]
+		}
+	}
+
+	if idx := strings.IndexAny(jsonStr, "{["); idx > 0 {
+		jsonStr = jsonStr[idx:]
+	}
+	return strings.TrimSpace(jsonStr)
+}
+
+// repairJSON fixes the defects LLMs commonly produce: single-quoted strings,
+// trailing commas, and documents truncated by max_tokens, which are cut back
+// to the last complete value and closed.
+func repairJSON(s string) string {
+	s = doubleQuote(s)
+	s = closeTruncated(s)
+	return dropTrailingCommas(s)
+}
+
+// doubleQuote converts single-quoted strings to double-quoted ones.
+func doubleQuote(s string) string {
+	var sb strings.Builder
+	var quote rune // current string delimiter, 0 outside strings
+	escaped := false
+
+	for _, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+			if quote == '\'' && r == '\'' {
+				sb.WriteRune('\'') // \' is not a valid JSON escape
+				continue
+			}
+			sb.WriteRune('\\')
+			sb.WriteRune(r)
+			continue
+		case quote != 0 && r == '\\':
+			escaped = true
+			continue
+		case quote == 0 && (r == '"' || r == '\''):
+			quote = r
+			sb.WriteRune('"')
+			continue
+		case quote != 0 && r == quote:
+			quote = 0
+			sb.WriteRune('"')
+			continue
+		case quote == '\'' && r == '"':
+			sb.WriteString(`\"`)
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// dropTrailingCommas removes commas directly before a closing bracket.
+func dropTrailingCommas(s string) string {
+	var sb strings.Builder
+	inString, escaped := false, false
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if inString {
+			sb.WriteByte(c)
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+
+		if c == '"' {
+			inString = true
+		}
+		if c == ',' {
+			rest := strings.TrimLeft(s[i+1:], " \t\r\n")
+			if rest == "" || rest[0] == '}' || rest[0] == ']' {
+				continue
+			}
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
+
+// closeTruncated cuts a truncated document back to its last complete value
+// and appends the missing closing brackets. Partially written objects inside
+// arrays are dropped rather than closed, so a cut-off theme does not show up
+// with half its fields missing.
+func closeTruncated(s string) string {
+	type level struct {
+		open       byte
+		afterColon bool // in an object, whether a value is expected or in progress
+	}
+
+	var stack []level
+	inString, escaped := false, false
+	safe := -1 // end of the longest prefix that ends on a complete value
+	var safeStack []level
+
+	markSafe := func(end int) {
+		safe = end
+		safeStack = append(safeStack[:0], stack...)
+	}
+	// completesValue reports whether a value ending here leaves a usable
+	// prefix: an array element, or a field of the top-level object
+	completesValue := func() bool {
+		if len(stack) == 0 {
+			return false
+		}
+		top := stack[len(stack)-1]
+		return top.open == '[' || (top.afterColon && len(stack) == 1)
+	}
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+				if completesValue() {
+					markSafe(i + 1)
+				}
+			}
+			continue
+		}
+
+		switch c {
+		case '"':
+			inString = true
+		case '{', '[':
+			stack = append(stack, level{open: c})
+			if c == '[' || len(stack) == 1 {
+				markSafe(i + 1)
+			}
+		case '}', ']':
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+			if len(stack) == 0 {
+				return s[:i+1]
+			}
+			markSafe(i + 1)
+		case ':':
+			if len(stack) > 0 {
+				stack[len(stack)-1].afterColon = true
+			}
+		case ',':
+			if completesValue() {
+				markSafe(i)
+			}
+			if len(stack) > 0 && stack[len(stack)-1].open == '{' {
+				stack[len(stack)-1].afterColon = false
+			}
+		}
+	}
+
+	if len(stack) == 0 && !inString {
+		return s
+	}
+	if safe < 0 {
+		return s
+	}
+
+	var sb strings.Builder
+	sb.WriteString(strings.TrimRight(s[:safe], " \t\r\n,"))
+	for i := len(safeStack) - 1; i >= 0; i-- {
+		if safeStack[i].open == '{' {
+			sb.WriteByte('}')
+		} else {
+			sb.WriteByte(']')
+		}
+	}
+	return sb.String()
+}
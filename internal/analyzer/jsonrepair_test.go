@@ -0,0 +1,197 @@
+package analyzer
+
+import "testing"
+
+func TestRepairJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "valid input unchanged",
+			in:   `{"themes":[{"name":"a"}]}`,
+			want: `{"themes":[{"name":"a"}]}`,
+		},
+		{
+			name: "trailing commas",
+			in:   `{"themes":[{"name":"a",},{"name":"b"},],}`,
+			want: `{"themes":[{"name":"a"},{"name":"b"}]}`,
+		},
+		{
+			name: "trailing comma before whitespace",
+			in:   "{\"items\":[1,2,\n  ]\n}",
+			want: "{\"items\":[1,2\n  ]\n}",
+		},
+		{
+			name: "commas and brackets inside strings kept",
+			in:   `{"quote":"a, ]b,}","n":1,}`,
+			want: `{"quote":"a, ]b,}","n":1}`,
+		},
+		{
+			name: "single quotes",
+			in:   `{'name': 'it\'s "quoted"'}`,
+			want: `{"name": "it's \"quoted\""}`,
+		},
+		{
+			name: "unclosed string in array",
+			in:   `{"themes":[{"name":"a"}],"key_insights":["one","tw`,
+			want: `{"themes":[{"name":"a"}],"key_insights":["one"]}`,
+		},
+		{
+			name: "unclosed array",
+			in:   `{"themes":[{"name":"a"}],"action_items":["do it"`,
+			want: `{"themes":[{"name":"a"}],"action_items":["do it"]}`,
+		},
+		{
+			name: "empty unclosed array",
+			in:   `{"themes":[{"name":"a"}],"key_insights":[`,
+			want: `{"themes":[{"name":"a"}],"key_insights":[]}`,
+		},
+		{
+			name: "partial object in array dropped",
+			in:   `{"themes":[{"name":"a","examples":["x","y"]},{"name":"b","descr`,
+			want: `{"themes":[{"name":"a","examples":["x","y"]}]}`,
+		},
+		{
+			name: "cut in a key",
+			in:   `{"themes":[{"name":"a"}],"key_ins`,
+			want: `{"themes":[{"name":"a"}]}`,
+		},
+		{
+			name: "cut in a literal",
+			in:   `{"a":1,"b":tru`,
+			want: `{"a":1}`,
+		},
+		{
+			name: "cut in a number",
+			in:   `{"themes":[{"name":"a"}],"count":12`,
+			want: `{"themes":[{"name":"a"}]}`,
+		},
+		{
+			name: "cut after an escaped quote",
+			in:   `{"quotes":["say \"hi\"","unfinished \"`,
+			want: `{"quotes":["say \"hi\""]}`,
+		},
+		{
+			name: "text after the document dropped",
+			in:   `{"a":[1]} trailing prose`,
+			want: `{"a":[1]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := repairJSON(tt.in); got != tt.want {
+				t.Errorf("repairJSON(%s)\n got  %s\n want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain", `{"a":1}`, `{"a":1}`},
+		{"json fence", "```json\n{\"a\":1}\n```", `{"a":1}`},
+		{"bare fence", "```\n[1,2]\n```", `[1,2]`},
+		{"fence with prose", "Here you go:\n```json\n{\"a\":1}\n```\nLet me know!", `{"a":1}`},
+		{"unclosed fence", "```json\n{\"a\":[1,", `{"a":[1,`},
+		{"leading prose", `Sure! {"a":1}`, `{"a":1}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := extractJSON(tt.in); got != tt.want {
+				t.Errorf("extractJSON(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    []string
+		wantErr bool
+	}{
+		{"valid", `{"key_insights":["a","b"]}`, []string{"a", "b"}, false},
+		{"fenced with trailing comma", "```json\n{\"key_insights\":[\"a\",\"b\",],}\n```", []string{"a", "b"}, false},
+		{"truncated", `{"key_insights":["a","b`, []string{"a"}, false},
+		{"type error not repaired", `{"key_insights":"a"}`, nil, true},
+		{"not JSON", `I could not find any themes.`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got rawAnalysis
+			err := decodeJSON(tt.in, &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeJSON error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(got.KeyInsights) != len(tt.want) {
+				t.Fatalf("key insights = %q, want %q", got.KeyInsights, tt.want)
+			}
+			for i := range tt.want {
+				if got.KeyInsights[i] != tt.want[i] {
+					t.Errorf("key insights = %q, want %q", got.KeyInsights, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestJoinContinuation(t *testing.T) {
+	tests := []struct {
+		name         string
+		content      string
+		continuation string
+		want         string
+	}{
+		{
+			name:         "continues mid-token",
+			content:      `{"themes":[{"name":"a","descr`,
+			continuation: `iption":"x"}]}`,
+			want:         `{"themes":[{"name":"a","description":"x"}]}`,
+		},
+		{
+			name:         "repeats the cut-off token",
+			content:      `{"themes":[{"name":"a","descr`,
+			continuation: `"description":"x"}]}`,
+			want:         `{"themes":[{"name":"a","description":"x"}]}`,
+		},
+		{
+			name:         "repeats the last values",
+			content:      `{"key_insights":["one","two","thr`,
+			continuation: `"two","three"]}`,
+			want:         `{"key_insights":["one","two","three"]}`,
+		},
+		{
+			name:         "restarts from scratch",
+			content:      `{"key_insights":["one","tw`,
+			continuation: "```json\n{\"key_insights\":[\"one\",\"two\"]}\n```",
+			want:         `{"key_insights":["one","two"]}`,
+		},
+		{
+			name:         "still incomplete",
+			content:      `{"key_insights":["one",`,
+			continuation: `"two",`,
+			want:         `{"key_insights":["one","two",`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := joinContinuation(tt.content, tt.continuation); got != tt.want {
+				t.Errorf("joinContinuation(%q, %q)\n got  %q\n want %q", tt.content, tt.continuation, got, tt.want)
+			}
+		})
+	}
+}
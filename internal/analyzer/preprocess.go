@@ -0,0 +1,236 @@
+package analyzer
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/defilan/issueparser/internal/llm"
+)
+
+const (
+	maxInlineCodeLines = 3   // shorter code blocks are kept verbatim
+	minLogRunLines     = 5   // unfenced log/stack trace runs shorter than this are kept
+	maxSignalLineRunes = 160 // longest error line quoted from a collapsed block
+)
+
+var (
+	htmlCommentRe  = regexp.MustCompile(`(?s)<!--.*?(-->|$)`)
+	detailsRe      = regexp.MustCompile(`(?is)<details>(.*?)</details>`)
+	summaryRe      = regexp.MustCompile(`(?is)<summary>(.*?)</summary>`)
+	imageRe        = regexp.MustCompile(`!\[[^\]]*\]\([^)]*\)`)
+	headingRe      = regexp.MustCompile(`^#{1,6}\s+\S`)
+	noResponseRe   = regexp.MustCompile(`(?i)^_?no response_?$`)
+	boilerplateRe  = regexp.MustCompile(`(?i)^[-*]\s*\[[ x]\]\s*(i have|i've|i agree|i searched|i confirm|i checked)`)
+	signalRe       = regexp.MustCompile(`(?i)(error|panic|exception|traceback|fatal|failed|oom|out of memory)`)
+	logLineRe      = regexp.MustCompile(`^\s*(\d{4}-\d{2}-\d{2}|\[?\d{2}:\d{2}:\d{2}|at [\w$.<>]+\(|File "|goroutine \d|Traceback \(|(?i:\[?(INFO|DEBUG|WARN|WARNING|ERROR|TRACE|FATAL)\]?[\s:])|[\w./*()-]+\(.*\)$)|\.(go|py|rs|java|js|ts|c|cc|cpp):\d+`)
+	logIndentRe    = regexp.MustCompile(`^(\s{4,}|\t)\S`) // indented lines only continue a log run
+	sentenceEndRe  = regexp.MustCompile(`[.!?]["')\]]?$`)
+	fenceRe        = regexp.MustCompile("^\\s*(```|~~~)\\s*(\\S*)")
+	blankLinesRe   = regexp.MustCompile(`\n{3,}`)
+	htmlTagRe      = regexp.MustCompile(`(?i)</?(br|p|div|span|b|i|em|strong|code|pre|sub|sup)\s*/?>`)
+	trailingSpaces = regexp.MustCompile(`[ \t]+\n`)
+)
+
+// cleanBody prepares an issue or comment body for a prompt. It removes issue
+// template boilerplate and HTML comments, and collapses code blocks, log dumps
+// and stack traces into one-line summaries that keep the most telling error
+// line. Markdown structure (line breaks) is preserved for the caller.
+func cleanBody(body string) string {
+	body = strings.ReplaceAll(body, "\r\n", "\n")
+	body = htmlCommentRe.ReplaceAllString(body, "")
+	body = detailsRe.ReplaceAllStringFunc(body, collapseDetails)
+	body = imageRe.ReplaceAllString(body, "[image]")
+	body = htmlTagRe.ReplaceAllString(body, " ")
+
+	lines := collapseCodeBlocks(strings.Split(body, "\n"))
+	lines = collapseLogRuns(lines)
+	lines = dropBoilerplate(lines)
+
+	body = strings.Join(lines, "\n")
+	body = trailingSpaces.ReplaceAllString(body, "\n")
+	body = blankLinesRe.ReplaceAllString(body, "\n\n")
+	return strings.TrimSpace(body)
+}
+
+// collapseCodeBlocks replaces fenced blocks longer than a few lines with a
+// summary such as "[python code, 40 lines: ValueError: bad shape]".
+func collapseCodeBlocks(lines []string) []string {
+	var out []string
+
+	for i := 0; i < len(lines); i++ {
+		m := fenceRe.FindStringSubmatch(lines[i])
+		if m == nil {
+			out = append(out, lines[i])
+			continue
+		}
+
+		// A fence closed on its own line is inline code
+		opening := strings.TrimSpace(lines[i])
+		if strings.Contains(opening[len(m[1]):], m[1]) {
+			out = append(out, lines[i])
+			continue
+		}
+
+		// Find the closing fence; an unclosed fence is left as it is
+		end := -1
+		for j := i + 1; j < len(lines); j++ {
+			if strings.HasPrefix(strings.TrimSpace(lines[j]), m[1]) {
+				end = j
+				break
+			}
+		}
+		if end < 0 {
+			out = append(out, lines[i])
+			continue
+		}
+
+		block := lines[i+1 : end]
+		if len(block) <= maxInlineCodeLines {
+			out = append(out, strings.Join(block, " "))
+		} else {
+			kind := "code"
+			if m[2] != "" {
+				kind = m[2] + " code"
+			}
+			out = append(out, summarizeBlock(kind, block))
+		}
+		i = end
+	}
+
+	return out
+}
+
+// collapseLogRuns replaces runs of unfenced log or stack trace lines. A run
+// starts at a line with a timestamp, log level or stack frame; indented lines
+// only continue one, so indented lists and steps are kept.
+func collapseLogRuns(lines []string) []string {
+	var out []string
+
+	for i := 0; i < len(lines); {
+		j := i
+		for j < len(lines) && (logLineRe.MatchString(lines[j]) || (j > i && logIndentRe.MatchString(lines[j]))) {
+			j++
+		}
+
+		if j-i >= minLogRunLines {
+			out = append(out, summarizeBlock("log", lines[i:j]))
+			i = j
+			continue
+		}
+
+		if j == i {
+			j++
+		}
+		out = append(out, lines[i:j]...)
+		i = j
+	}
+
+	return out
+}
+
+func summarizeBlock(kind string, block []string) string {
+	for _, line := range block {
+		if signalRe.MatchString(line) {
+			return fmt.Sprintf("[%s, %d lines: %s]", kind, len(block),
+				truncateRunes(strings.TrimSpace(line), maxSignalLineRunes))
+		}
+	}
+	return fmt.Sprintf("[%s, %d lines]", kind, len(block))
+}
+
+func collapseDetails(details string) string {
+	label := "details"
+	if m := summaryRe.FindStringSubmatch(details); m != nil {
+		label = strings.TrimSpace(m[1])
+	}
+	inner := summaryRe.ReplaceAllString(detailsRe.FindStringSubmatch(details)[1], "")
+	return summarizeBlock(label, strings.Split(strings.TrimSpace(inner), "\n"))
+}
+
+// dropBoilerplate removes "_No response_" placeholders, template
+// acknowledgement checkboxes and headings left with nothing under them.
+func dropBoilerplate(lines []string) []string {
+	var kept []string
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if noResponseRe.MatchString(trimmed) || boilerplateRe.MatchString(trimmed) {
+			continue
+		}
+		kept = append(kept, line)
+	}
+
+	var out []string
+	for i, line := range kept {
+		if headingRe.MatchString(strings.TrimSpace(line)) && !sectionHasContent(kept[i+1:]) {
+			continue
+		}
+		out = append(out, line)
+	}
+	return out
+}
+
+func sectionHasContent(rest []string) bool {
+	for _, line := range rest {
+		trimmed := strings.TrimSpace(line)
+		if headingRe.MatchString(trimmed) {
+			return false
+		}
+		if trimmed != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// truncateTokens shortens s to roughly maxTokens. It cuts between words, and
+// backs up to the last sentence end when that keeps most of the allowed text.
+// When not even the first word fits, e.g. in CJK text without spaces or a
+// long URL or log line, it cuts that word between runes instead.
+func truncateTokens(s string, maxTokens int) string {
+	if llm.EstimateTokens(s) <= maxTokens {
+		return s
+	}
+
+	words := strings.Fields(s)
+	used := 0
+	n := 0
+	for ; n < len(words); n++ {
+		tokens := llm.EstimateTokens(words[n])
+		if used+tokens > maxTokens {
+			break
+		}
+		used += tokens
+	}
+	if n == 0 {
+		return truncateWordTokens(words[0], maxTokens) + " [truncated]"
+	}
+
+	for k := n; k > n*2/3 && k > 0; k-- {
+		if sentenceEndRe.MatchString(words[k-1]) {
+			return strings.Join(words[:k], " ") + " [truncated]"
+		}
+	}
+	return strings.Join(words[:n], " ") + " [truncated]"
+}
+
+// truncateWordTokens returns the longest prefix of word, cut between runes,
+// that fits into maxTokens.
+func truncateWordTokens(word string, maxTokens int) string {
+	runes := []rune(word)
+	n := sort.Search(len(runes), func(i int) bool {
+		return llm.EstimateTokens(string(runes[:i+1])) > maxTokens
+	})
+	return string(runes[:n])
+}
+
+// truncateRunes shortens s to at most n runes without splitting a rune.
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:n]) + "..."
+}
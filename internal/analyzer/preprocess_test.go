@@ -0,0 +1,137 @@
+package analyzer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/defilan/issueparser/internal/llm"
+)
+
+func TestCleanBody(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "fence opened and closed on one line",
+			in:   "```pip install vllm```\nThen start the server.\nIt crashes with OOM on 2x A100.",
+			want: "```pip install vllm```\nThen start the server.\nIt crashes with OOM on 2x A100.",
+		},
+		{
+			name: "unclosed fence kept",
+			in:   "```\nunclosed\nblock text",
+			want: "```\nunclosed\nblock text",
+		},
+		{
+			name: "short code block inlined",
+			in:   "Run:\n```bash\nvllm serve model\n```\nthen it fails.",
+			want: "Run:\nvllm serve model\nthen it fails.",
+		},
+		{
+			name: "long code block collapsed",
+			in:   "```python\nimport a\nimport b\nimport c\nraise ValueError('x')\n```\nafter",
+			want: "[python code, 4 lines: raise ValueError('x')]\nafter",
+		},
+		{
+			name: "log run collapsed",
+			in: "Log:\n2024-01-01 10:00:00 INFO start\n2024-01-01 10:00:01 INFO load\n" +
+				"2024-01-01 10:00:02 ERROR CUDA out of memory\n2024-01-01 10:00:03 INFO retry\n2024-01-01 10:00:04 INFO exit\nafter",
+			want: "Log:\n[log, 5 lines: 2024-01-01 10:00:02 ERROR CUDA out of memory]\nafter",
+		},
+		{
+			name: "traceback collapsed",
+			in: "Traceback (most recent call last):\n  File \"a.py\", line 1, in <module>\n    main()\n" +
+				"  File \"b.py\", line 2, in main\n    raise ValueError(\"bad shape\")\nValueError: bad shape\nThat's it.",
+			want: "[log, 5 lines: Traceback (most recent call last):]\nValueError: bad shape\nThat's it.",
+		},
+		{
+			name: "short log run kept",
+			in:   "2024-01-01 10:00:00 INFO start\n2024-01-01 10:00:02 ERROR boom",
+			want: "2024-01-01 10:00:00 INFO start\n2024-01-01 10:00:02 ERROR boom",
+		},
+		{
+			name: "indented steps kept",
+			in: "Steps:\n1. Install\n    - pip install vllm\n    - set CUDA_VISIBLE_DEVICES=0,1\n" +
+				"    - run the server\n    - send 10 requests\n    - watch memory\nDone.",
+			want: "Steps:\n1. Install\n    - pip install vllm\n    - set CUDA_VISIBLE_DEVICES=0,1\n" +
+				"    - run the server\n    - send 10 requests\n    - watch memory\nDone.",
+		},
+		{
+			name: "prose starting with at",
+			in:   "We need at least 5 GPUs.",
+			want: "We need at least 5 GPUs.",
+		},
+		{
+			name: "template boilerplate dropped",
+			in: "<!-- Please describe the bug -->\n### Describe the bug\nIt hangs.\n\n### Logs\n\n_No response_\n\n" +
+				"- [x] I have searched existing issues",
+			want: "### Describe the bug\nIt hangs.",
+		},
+		{
+			name: "details and images collapsed",
+			in:   "See ![screenshot](https://x/y.png)\n<details><summary>env</summary>\ntorch 2.1\n</details>",
+			want: "See [image]\n[env, 1 lines]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cleanBody(tt.in); got != tt.want {
+				t.Errorf("cleanBody(%q)\n got  %q\n want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruncateTokens(t *testing.T) {
+	tests := []struct {
+		name      string
+		in        string
+		maxTokens int
+		want      string
+	}{
+		{
+			name:      "within budget",
+			in:        "short text",
+			maxTokens: 10,
+			want:      "short text",
+		},
+		{
+			name:      "back to sentence end",
+			in:        "The server crashes on start. It happens with two GPUs and more than eight concurrent requests in flight",
+			maxTokens: 12,
+			want:      "The server crashes on start. [truncated]",
+		},
+		{
+			name:      "between words",
+			in:        "one two three four five six seven eight nine ten eleven twelve",
+			maxTokens: 5,
+			want:      "one two three four [truncated]",
+		},
+		{
+			name:      "text without spaces",
+			in:        strings.Repeat("漢字", 50),
+			maxTokens: 10,
+			want:      "漢字漢字漢字漢字漢字 [truncated]",
+		},
+		{
+			name:      "long first word",
+			in:        "https://example.com/" + strings.Repeat("abcdefgh", 20) + " see log",
+			maxTokens: 20,
+			want:      "https://example.com/" + strings.Repeat("abcdefgh", 5) + " [truncated]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncateTokens(tt.in, tt.maxTokens)
+			if got != tt.want {
+				t.Errorf("truncateTokens(%q, %d)\n got  %q\n want %q", tt.in, tt.maxTokens, got, tt.want)
+			}
+			if kept := strings.TrimSuffix(got, " [truncated]"); llm.EstimateTokens(kept) > tt.maxTokens {
+				t.Errorf("kept %d tokens, over the budget of %d", llm.EstimateTokens(kept), tt.maxTokens)
+			}
+		})
+	}
+}
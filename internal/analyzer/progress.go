@@ -0,0 +1,30 @@
+package analyzer
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/defilan/issueparser/internal/llm"
+)
+
+const progressInterval = 10 * time.Second
+
+// streamProgress returns a callback that logs a streamed response every
+// progressInterval and once it is complete. Lines are printed whole rather
+// than redrawn so they stay readable in job logs and with concurrent
+// requests.
+func streamProgress(label string) func(llm.StreamProgress) {
+	var lastLog time.Duration
+	return func(p llm.StreamProgress) {
+		if p.Done {
+			fmt.Printf("    %s: %d tokens in %s (%.1f tok/s)\n",
+				label, p.Tokens, p.Elapsed.Round(time.Second), p.TokensPerSecond())
+			lastLog = 0
+			return
+		}
+		if p.Elapsed-lastLog >= progressInterval {
+			lastLog = p.Elapsed
+			fmt.Printf("    %s: %d tokens so far (%.1f tok/s)...\n", label, p.Tokens, p.TokensPerSecond())
+		}
+	}
+}
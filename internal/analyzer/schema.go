@@ -0,0 +1,110 @@
+package analyzer
+
+import (
+	"encoding/json"
+
+	"github.com/defilan/issueparser/internal/llm"
+)
+
+// JSON schemas for each prompt's response. They mirror the "Required JSON
+// structure" in the prompts and are sent to servers that support structured
+// output so responses are guaranteed to parse.
+var (
+	batchSchema = &llm.Schema{Name: "batch_analysis", Definition: json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "themes": {"type": "array", "items": {
+      "type": "object",
+      "properties": {
+        "name": {"type": "string"},
+        "description": {"type": "string"},
+        "issues": {"type": "array", "items": {"type": "string"}},
+        "severity": {"type": "string", "enum": ["high", "medium", "low"]},
+        "example_quotes": {"type": "array", "items": {"type": "string"}}
+      },
+      "required": ["name", "description", "issues", "severity", "example_quotes"],
+      "additionalProperties": false
+    }},
+    "notable_quotes": {"type": "array", "items": {
+      "type": "object",
+      "properties": {
+        "text": {"type": "string"},
+        "issue": {"type": "string"}
+      },
+      "required": ["text", "issue"],
+      "additionalProperties": false
+    }}
+  },
+  "required": ["themes", "notable_quotes"],
+  "additionalProperties": false
+}`)}
+
+	mergeSchema = &llm.Schema{Name: "merged_analysis", Definition: json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "themes": {"type": "array", "items": ` + mergedThemeSchema + `}
+  },
+  "required": ["themes"],
+  "additionalProperties": false
+}`)}
+
+	synthesisSchema = &llm.Schema{Name: "synthesis", Definition: json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "themes": {"type": "array", "items": ` + mergedThemeSchema + `},
+    "key_insights": {"type": "array", "items": {"type": "string"}},
+    "action_items": {"type": "array", "items": {"type": "string"}}
+  },
+  "required": ["themes", "key_insights", "action_items"],
+  "additionalProperties": false
+}`)}
+
+	classifySchema = &llm.Schema{Name: "issue_classification", Definition: json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "kind": {"type": "string", "enum": ["bug", "feature", "question", "other"]},
+    "category": {"type": "string"},
+    "severity": {"type": "string", "enum": ["high", "medium", "low"]},
+    "component": {"type": "string"},
+    "summary": {"type": "string"}
+  },
+  "required": ["kind", "category", "severity", "component", "summary"],
+  "additionalProperties": false
+}`)}
+
+	clusterThemeSchema = &llm.Schema{Name: "cluster_theme", Definition: json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "name": {"type": "string"},
+    "description": {"type": "string"},
+    "severity": {"type": "string", "enum": ["high", "medium", "low"]},
+    "example_quotes": {"type": "array", "items": {"type": "string"}}
+  },
+  "required": ["name", "description", "severity", "example_quotes"],
+  "additionalProperties": false
+}`)}
+
+	clusterSummarySchema = &llm.Schema{Name: "cluster_summary", Definition: json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "key_insights": {"type": "array", "items": {"type": "string"}},
+    "action_items": {"type": "array", "items": {"type": "string"}}
+  },
+  "required": ["key_insights", "action_items"],
+  "additionalProperties": false
+}`)}
+)
+
+// mergedThemeSchema is a theme that cites the input themes it combines.
+const mergedThemeSchema = `{
+  "type": "object",
+  "properties": {
+    "name": {"type": "string"},
+    "description": {"type": "string"},
+    "sources": {"type": "array", "items": {"type": "string"}},
+    "severity": {"type": "string", "enum": ["high", "medium", "low"]},
+    "examples": {"type": "array", "items": {"type": "string"}}
+  },
+  "required": ["name", "description", "sources", "severity", "examples"],
+  "additionalProperties": false
+}`
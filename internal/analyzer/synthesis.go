@@ -0,0 +1,461 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/defilan/issueparser/internal/github"
+	"github.com/defilan/issueparser/internal/llm"
+)
+
+const maxNotableQuotes = 10
+
+// rawAnalysis is the JSON shape returned by the batch, merge and synthesis
+// prompts. Themes from merge and synthesis steps cite the input themes they
+// combine via Sources, which lets us carry issue references forward without
+// asking the model to copy them.
+type rawAnalysis struct {
+	Themes        []rawTheme `json:"themes"`
+	KeyInsights   []string   `json:"key_insights"`
+	NotableQuotes []rawQuote `json:"notable_quotes"`
+	ActionItems   []string   `json:"action_items"`
+
+	verification Verification // citation checks of this analysis and its inputs
+}
+
+type rawTheme struct {
+	Name          string    `json:"name"`
+	Description   string    `json:"description"`
+	Issues        []issueID `json:"issues"`
+	IssueCount    int       `json:"issue_count"`
+	Severity      string    `json:"severity"`
+	Sources       []string  `json:"sources"`
+	Examples      []string  `json:"examples"`
+	ExampleQuotes []string  `json:"example_quotes"`
+
+	Refs []github.IssueRef `json:"-"` // resolved from Issues or Sources
+}
+
+type rawQuote struct {
+	Text  string  `json:"text"`
+	Issue issueID `json:"issue"`
+
+	Ref      *github.IssueRef `json:"-"`
+	Verified bool             `json:"-"` // text was found in the cited issue
+	checked  bool             // verified at an earlier stage
+}
+
+// issueID is an issue reference as written by the model. It accepts
+// "owner/repo#123", "#123" or a bare number.
+type issueID string
+
+func (id *issueID) UnmarshalJSON(data []byte) error {
+	var n int
+	if err := json.Unmarshal(data, &n); err == nil {
+		*id = issueID(strconv.Itoa(n))
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	*id = issueID(s)
+	return nil
+}
+
+// resolveRefs maps the issue IDs cited in a batch analysis to the issues of
+// that batch. IDs that do not match an issue in the batch are dropped and
+// counted as rejected, and a bare number only resolves when it is
+// unambiguous within the batch.
+func resolveRefs(raw *rawAnalysis, batch []github.Issue) {
+	known := make(map[github.IssueRef]bool)
+	byNumber := make(map[int][]github.IssueRef)
+	for _, issue := range batch {
+		ref := issue.Ref()
+		known[ref] = true
+		byNumber[issue.Number] = append(byNumber[issue.Number], ref)
+	}
+
+	resolve := func(id issueID) (github.IssueRef, bool) {
+		if ref, err := github.ParseIssueRef(string(id)); err == nil {
+			return ref, known[ref]
+		}
+		n, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(string(id)), "#"))
+		if err != nil || len(byNumber[n]) != 1 {
+			return github.IssueRef{}, false
+		}
+		return byNumber[n][0], true
+	}
+
+	stats := &raw.verification
+	for i := range raw.Themes {
+		theme := &raw.Themes[i]
+		seen := make(map[github.IssueRef]bool)
+		for _, id := range theme.Issues {
+			stats.CitedIssues++
+			ref, ok := resolve(id)
+			if !ok {
+				stats.RejectedIssues++
+				continue
+			}
+			if !seen[ref] {
+				seen[ref] = true
+				theme.Refs = append(theme.Refs, ref)
+			}
+		}
+	}
+
+	for i := range raw.NotableQuotes {
+		if raw.NotableQuotes[i].Issue == "" {
+			continue
+		}
+		stats.CitedIssues++
+		if ref, ok := resolve(raw.NotableQuotes[i].Issue); ok {
+			raw.NotableQuotes[i].Ref = &ref
+		} else {
+			stats.RejectedIssues++
+		}
+	}
+}
+
+func (a *Analyzer) synthesizeAnalyses(ctx context.Context, batchAnalyses []*rawAnalysis, issues []github.Issue,
+	classifications []IssueClassification, opts Options) (*Analysis, error) {
+	// Build issue URL lookup
+	issueURLs := make(map[github.IssueRef]string)
+	for _, issue := range issues {
+		issueURLs[issue.Ref()] = issue.HTMLURL
+	}
+
+	if len(batchAnalyses) == 0 {
+		return &Analysis{RawIssueCount: len(issues)}, nil
+	}
+
+	// Merged examples are checked against every issue, since a merged theme
+	// can draw on any batch
+	verifier := newQuoteVerifier(issues)
+
+	// Reduce the analyses level by level until they fit into a single
+	// synthesis prompt. Each merge produces output no larger than a batch
+	// analysis, so every level shrinks the set.
+	for level := 1; len(batchAnalyses) > 1; level++ {
+		if totalTokens(batchAnalyses) <= promptBudget(opts, synthesisMaxTokens) {
+			break
+		}
+
+		groups := groupAnalyses(batchAnalyses, promptBudget(opts, batchMaxTokens))
+		if len(groups) == len(batchAnalyses) {
+			// Nothing left to merge, e.g. after failed merges were kept
+			// unmerged; the synthesis prompt has to take them as they are
+			break
+		}
+		fmt.Printf("  Merging %d analyses into %d groups (level %d)...\n", len(batchAnalyses), len(groups), level)
+
+		merged := make([]*rawAnalysis, len(groups))
+		err := parallel(ctx, len(groups), opts.Concurrency, func(ctx context.Context, i int) error {
+			if len(groups[i]) == 1 {
+				merged[i] = groups[i][0]
+				return nil
+			}
+			label := fmt.Sprintf("Merge level %d group %d", level, i+1)
+			result, err := a.mergeAnalyses(ctx, groups[i], verifier, label, opts)
+			if errors.Is(err, llm.ErrCircuitOpen) {
+				return fmt.Errorf("merge level %d group %d: %w", level, i+1, err)
+			}
+			if err != nil {
+				// Keep the group's themes unmerged rather than losing the batch results
+				fmt.Printf("  Warning: merge level %d group %d failed (%v), keeping its themes unmerged\n", level, i+1, err)
+				merged[i] = concatAnalyses(groups[i])
+				return nil
+			}
+			merged[i] = result
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		batchAnalyses = merged
+	}
+
+	// If only one analysis remains, use it directly
+	if len(batchAnalyses) == 1 {
+		return buildAnalysis(batchAnalyses[0], issueURLs, len(issues)), nil
+	}
+
+	// Otherwise, ask LLM to synthesize
+	systemPrompt := `You synthesize multiple issue analyses into a final report. Merge similar themes, rank by importance.
+Each input theme has an ID like T3. List the IDs of every input theme a final theme covers in "sources".
+
+IMPORTANT: Respond with ONLY valid JSON. No markdown, no explanations. Be concise.
+
+Required JSON structure:
+{"themes":[{"name":"string","description":"string","sources":["T1","T4"],"severity":"high|medium|low","examples":["quote1","quote2"]}],"key_insights":["insight1"],"action_items":["action1"]}`
+	if opts.Prompts.Synthesis != "" {
+		systemPrompt = opts.Prompts.Synthesis
+	}
+
+	var groundTruth string
+	if len(classifications) > 0 {
+		groundTruth = fmt.Sprintf("Per-issue classification counts (ground truth, %d issues):\n%s\n\n",
+			len(classifications), classificationCounts(classifications))
+	}
+
+	userPrompt := fmt.Sprintf(`Synthesize these analyses about %s into 5-7 final themes:
+
+%s%s
+
+Respond with JSON only.`, strings.Join(opts.FocusAreas, ", "), groundTruth, formatAnalyses(batchAnalyses))
+
+	var raw rawAnalysis
+	err := a.completeJSON(ctx, stageSynthesis, systemPrompt, userPrompt, llm.CallOptions{
+		MaxTokens:  synthesisMaxTokens,
+		Schema:     synthesisSchema,
+		Sampling:   opts.SynthesisSampling,
+		OnProgress: streamProgress("Synthesis"),
+	}, opts, &raw)
+	if errors.Is(err, errInvalidJSON) {
+		// Report the unmerged themes rather than losing the batch results
+		fmt.Printf("  Warning: synthesis failed (%v), reporting unmerged themes\n", err)
+		return buildAnalysis(concatAnalyses(batchAnalyses), issueURLs, len(issues)), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("synthesis failed: %w", err)
+	}
+
+	resolveSources(&raw, batchAnalyses)
+	verifyQuotes(&raw, verifier, opts.DropUnverifiedQuotes, checkedExamples(batchAnalyses))
+	return buildAnalysis(&raw, issueURLs, len(issues)), nil
+}
+
+// mergeAnalyses combines a group of partial analyses into one intermediate
+// analysis that can be merged again at the next level.
+func (a *Analyzer) mergeAnalyses(ctx context.Context, analyses []*rawAnalysis, verifier *quoteVerifier, label string,
+	opts Options) (*rawAnalysis, error) {
+	systemPrompt := `You merge partial issue analyses into one combined analysis. Merge similar themes and keep the most representative quotes.
+Each input theme has an ID like T3. List the IDs of every input theme a merged theme covers in "sources".
+
+IMPORTANT: Respond with ONLY valid JSON, no markdown, no explanations. Keep responses concise.
+
+Required JSON structure:
+{"themes":[{"name":"string","description":"string","sources":["T1","T4"],"severity":"high|medium|low","examples":["quote1","quote2"]}]}`
+	if opts.Prompts.Merge != "" {
+		systemPrompt = opts.Prompts.Merge
+	}
+
+	userPrompt := fmt.Sprintf(`Merge these analyses about %s into at most 7 themes:
+
+%s
+
+Respond with JSON only.`, strings.Join(opts.FocusAreas, ", "), formatAnalyses(analyses))
+
+	var raw rawAnalysis
+	if err := a.completeJSON(ctx, stageMerge, systemPrompt, userPrompt, llm.CallOptions{
+		MaxTokens:  batchMaxTokens,
+		Schema:     mergeSchema,
+		Sampling:   opts.SynthesisSampling,
+		OnProgress: streamProgress(label),
+	}, opts, &raw); err != nil {
+		return nil, err
+	}
+
+	resolveSources(&raw, analyses)
+	verifyQuotes(&raw, verifier, opts.DropUnverifiedQuotes, checkedExamples(analyses))
+	return &raw, nil
+}
+
+// resolveSources replaces each theme's source IDs with the union of the issue
+// references of the input themes it cites, and carries the inputs' notable
+// quotes forward.
+func resolveSources(raw *rawAnalysis, inputs []*rawAnalysis) {
+	sources := themeIDs(inputs)
+
+	for i := range raw.Themes {
+		theme := &raw.Themes[i]
+		seen := make(map[github.IssueRef]bool)
+		var refs []github.IssueRef
+		count := 0
+
+		for _, id := range theme.Sources {
+			source, ok := sources[strings.ToUpper(strings.TrimSpace(id))]
+			if !ok {
+				continue
+			}
+			count += themeIssueCount(source)
+			for _, ref := range source.Refs {
+				if !seen[ref] {
+					seen[ref] = true
+					refs = append(refs, ref)
+				}
+			}
+		}
+
+		sort.Slice(refs, func(i, j int) bool {
+			if refs[i].Repo != refs[j].Repo {
+				return refs[i].Repo < refs[j].Repo
+			}
+			return refs[i].Number < refs[j].Number
+		})
+		theme.Refs = refs
+		theme.IssueCount = count
+		if len(refs) > 0 {
+			theme.IssueCount = len(refs)
+		}
+		theme.Sources = nil
+	}
+
+	raw.NotableQuotes = nil
+	for _, input := range inputs {
+		raw.NotableQuotes = append(raw.NotableQuotes, input.NotableQuotes...)
+		raw.verification.add(input.verification)
+	}
+}
+
+// themeIDs assigns sequential IDs (T1, T2, ...) to the themes of a group of
+// analyses, in the order they are rendered by formatAnalyses.
+func themeIDs(analyses []*rawAnalysis) map[string]rawTheme {
+	ids := make(map[string]rawTheme)
+	n := 0
+	for _, analysis := range analyses {
+		for _, theme := range analysis.Themes {
+			n++
+			ids[fmt.Sprintf("T%d", n)] = theme
+		}
+	}
+	return ids
+}
+
+func formatAnalyses(analyses []*rawAnalysis) string {
+	var sb strings.Builder
+	n := 0
+	for i, analysis := range analyses {
+		fmt.Fprintf(&sb, "Batch %d:\n", i+1)
+		for _, theme := range analysis.Themes {
+			n++
+			sb.WriteString(formatTheme(fmt.Sprintf("T%d", n), theme))
+		}
+	}
+	return sb.String()
+}
+
+func formatTheme(id string, theme rawTheme) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s: %s [%s] (%d issues)\n%s\n", id, theme.Name, theme.Severity, themeIssueCount(theme), theme.Description)
+
+	examples := append(append([]string{}, theme.Examples...), theme.ExampleQuotes...)
+	if len(examples) > 2 {
+		examples = examples[:2]
+	}
+	for _, example := range examples {
+		fmt.Fprintf(&sb, "Example: %q\n", example)
+	}
+	return sb.String()
+}
+
+func themeIssueCount(theme rawTheme) int {
+	if theme.IssueCount == 0 {
+		return len(theme.Refs)
+	}
+	return theme.IssueCount
+}
+
+// groupAnalyses packs analyses into groups whose combined size fits the
+// budget. Groups hold at least two analyses so each merge level makes progress.
+func groupAnalyses(analyses []*rawAnalysis, budget int) [][]*rawAnalysis {
+	var groups [][]*rawAnalysis
+	var current []*rawAnalysis
+	used := 0
+
+	for _, analysis := range analyses {
+		tokens := llm.EstimateTokens(formatAnalyses([]*rawAnalysis{analysis}))
+		if len(current) >= 2 && used+tokens > budget {
+			groups = append(groups, current)
+			current, used = nil, 0
+		}
+		current = append(current, analysis)
+		used += tokens
+	}
+
+	if len(current) > 0 {
+		groups = append(groups, current)
+	}
+
+	return groups
+}
+
+func totalTokens(analyses []*rawAnalysis) int {
+	return llm.EstimateTokens(formatAnalyses(analyses))
+}
+
+// concatAnalyses combines analyses without merging their themes.
+func concatAnalyses(analyses []*rawAnalysis) *rawAnalysis {
+	combined := &rawAnalysis{}
+	for _, a := range analyses {
+		combined.Themes = append(combined.Themes, a.Themes...)
+		combined.KeyInsights = append(combined.KeyInsights, a.KeyInsights...)
+		combined.NotableQuotes = append(combined.NotableQuotes, a.NotableQuotes...)
+		combined.ActionItems = append(combined.ActionItems, a.ActionItems...)
+		combined.verification.add(a.verification)
+	}
+	return combined
+}
+
+func buildAnalysis(raw *rawAnalysis, issueURLs map[github.IssueRef]string, issueCount int) *Analysis {
+	// Convert to our Analysis struct
+	analysis := &Analysis{
+		RawIssueCount: issueCount,
+		KeyInsights:   raw.KeyInsights,
+		ActionItems:   raw.ActionItems,
+		Verification:  raw.verification,
+	}
+
+	for _, t := range raw.Themes {
+		theme := Theme{
+			Name:        t.Name,
+			Description: t.Description,
+			Severity:    t.Severity,
+			IssueCount:  themeIssueCount(t),
+			Issues:      t.Refs,
+		}
+
+		// Map issue references to URLs
+		for _, ref := range t.Refs {
+			if url, ok := issueURLs[ref]; ok {
+				theme.IssueURLs = append(theme.IssueURLs, url)
+			}
+		}
+
+		// Combine examples
+		theme.Examples = append(theme.Examples, t.Examples...)
+		theme.Examples = append(theme.Examples, t.ExampleQuotes...)
+
+		analysis.Themes = append(analysis.Themes, theme)
+	}
+
+	// Convert notable quotes, preferring ones found in the source issues
+	quotes := append([]rawQuote{}, raw.NotableQuotes...)
+	sort.SliceStable(quotes, func(i, j int) bool {
+		return quotes[i].Verified && !quotes[j].Verified
+	})
+	for i, q := range quotes {
+		if i >= maxNotableQuotes {
+			break
+		}
+		quote := Quote{
+			Text:     q.Text,
+			Verified: q.Verified,
+		}
+		if q.Ref != nil {
+			quote.Issue = q.Ref
+			quote.Source = fmt.Sprintf("Issue %s", q.Ref)
+			quote.IssueURL = issueURLs[*q.Ref]
+		}
+		analysis.Quotes = append(analysis.Quotes, quote)
+	}
+
+	return analysis
+}
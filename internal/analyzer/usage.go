@@ -0,0 +1,151 @@
+package analyzer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/defilan/issueparser/internal/llm"
+)
+
+// Analysis stages, as reported in usage accounting.
+const (
+	stageClassify       = "Classification"
+	stageBatch          = "Batch analysis"
+	stageMerge          = "Merge"
+	stageSynthesis      = "Synthesis"
+	stageClusterNaming  = "Cluster naming"
+	stageClusterSummary = "Cluster summary"
+)
+
+// StageUsage aggregates the LLM calls of one analysis stage. Latency is
+// summed across calls, so with concurrency it exceeds the stage's wall
+// clock time. Calls answered from the response cache count towards
+// CachedCalls only, since they cost neither tokens nor time.
+type StageUsage struct {
+	Stage            string        `json:"stage"`
+	Calls            int           `json:"calls"`
+	CachedCalls      int           `json:"cached_calls"`
+	PromptTokens     int           `json:"prompt_tokens"`
+	CompletionTokens int           `json:"completion_tokens"`
+	TotalTokens      int           `json:"total_tokens"`
+	Latency          time.Duration `json:"latency"`
+	Estimated        bool          `json:"estimated"` // the server did not report usage for some calls
+}
+
+// TokensPerSecond is the average generation speed of the stage's calls.
+func (u StageUsage) TokensPerSecond() float64 {
+	if u.Latency <= 0 {
+		return 0
+	}
+	return float64(u.CompletionTokens) / u.Latency.Seconds()
+}
+
+// Cost estimates the stage's cost at the given prices.
+func (u StageUsage) Cost(p Pricing) float64 {
+	return float64(u.PromptTokens)/1000*p.PromptPer1K + float64(u.CompletionTokens)/1000*p.CompletionPer1K
+}
+
+// Pricing is the price per 1,000 tokens of a hosted provider.
+type Pricing struct {
+	PromptPer1K     float64
+	CompletionPer1K float64
+}
+
+func (p Pricing) IsZero() bool {
+	return p.PromptPer1K == 0 && p.CompletionPer1K == 0
+}
+
+// TotalUsage sums usage across stages.
+func TotalUsage(stages []StageUsage) StageUsage {
+	total := StageUsage{Stage: "Total"}
+	for _, u := range stages {
+		total.Calls += u.Calls
+		total.CachedCalls += u.CachedCalls
+		total.PromptTokens += u.PromptTokens
+		total.CompletionTokens += u.CompletionTokens
+		total.TotalTokens += u.TotalTokens
+		total.Latency += u.Latency
+		total.Estimated = total.Estimated || u.Estimated
+	}
+	return total
+}
+
+// usageTracker collects per-call usage for a run. A nil tracker ignores
+// calls, so stages can be run on their own.
+type usageTracker struct {
+	mu     sync.Mutex
+	stages []*StageUsage // in the order stages first ran
+}
+
+func newUsageTracker() *usageTracker {
+	return &usageTracker{}
+}
+
+// record adds a call. Servers that omit usage get an estimate from the
+// prompt and response text.
+func (t *usageTracker) record(stage string, messages []llm.Message, resp *llm.ChatResponse, latency time.Duration) {
+	if t == nil {
+		return
+	}
+
+	if resp.Cached {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.stage(stage).CachedCalls++
+		return
+	}
+
+	usage := resp.Usage
+	estimated := false
+	if usage.TotalTokens == 0 && usage.PromptTokens == 0 && usage.CompletionTokens == 0 {
+		estimated = true
+		for _, m := range messages {
+			usage.PromptTokens += llm.EstimateTokens(m.Content)
+		}
+		if len(resp.Choices) > 0 {
+			usage.CompletionTokens = llm.EstimateTokens(resp.Choices[0].Message.Content)
+		}
+	}
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	u := t.stage(stage)
+	u.Calls++
+	u.PromptTokens += usage.PromptTokens
+	u.CompletionTokens += usage.CompletionTokens
+	u.TotalTokens += usage.TotalTokens
+	u.Latency += latency
+	u.Estimated = u.Estimated || estimated
+}
+
+// stage returns the usage of the named stage, adding it on first use. The
+// caller must hold t.mu.
+func (t *usageTracker) stage(name string) *StageUsage {
+	for _, s := range t.stages {
+		if s.Stage == name {
+			return s
+		}
+	}
+	u := &StageUsage{Stage: name}
+	t.stages = append(t.stages, u)
+	return u
+}
+
+func (t *usageTracker) snapshot() []StageUsage {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stages := make([]StageUsage, len(t.stages))
+	for i, s := range t.stages {
+		stages[i] = *s
+	}
+	return stages
+}
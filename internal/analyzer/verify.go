@@ -0,0 +1,189 @@
+package analyzer
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/defilan/issueparser/internal/github"
+)
+
+const (
+	quoteShingleWords = 3   // quotes are compared as overlapping 3-word sequences
+	minQuoteOverlap   = 0.7 // share of a quote's sequences that must appear in the source
+)
+
+var ellipsisRe = regexp.MustCompile(`\.{3,}|…`)
+
+// quoteVerifier checks that quotes written by the model appear in the issues
+// it was shown. Matching ignores case and punctuation and tolerates elided
+// or lightly edited passages.
+type quoteVerifier struct {
+	issues []github.Issue
+	texts  map[github.IssueRef]*sourceText
+}
+
+type sourceText struct {
+	joined   string // normalized words separated by single spaces, padded with spaces
+	shingles map[string]bool
+}
+
+// newQuoteVerifier indexes the title, body and fetched comments of each
+// issue. The index is built up front so the verifier can be shared by
+// concurrent merges.
+func newQuoteVerifier(issues []github.Issue) *quoteVerifier {
+	v := &quoteVerifier{
+		issues: issues,
+		texts:  make(map[github.IssueRef]*sourceText, len(issues)),
+	}
+	for _, issue := range issues {
+		parts := []string{issue.Title, issue.Body}
+		for _, comment := range issue.Thread {
+			parts = append(parts, comment.Body)
+		}
+		v.texts[issue.Ref()] = newSourceText(strings.Join(parts, "\n"))
+	}
+	return v
+}
+
+func newSourceText(s string) *sourceText {
+	words := normalizeWords(s)
+	return &sourceText{
+		joined:   " " + strings.Join(words, " ") + " ",
+		shingles: shingles(words),
+	}
+}
+
+// find returns the issue a quote was taken from, checking the preferred
+// issues (usually the ones the model cited) before the rest.
+func (v *quoteVerifier) find(quote string, preferred []github.IssueRef) (github.IssueRef, bool) {
+	for _, ref := range preferred {
+		if text, ok := v.texts[ref]; ok && text.contains(quote) {
+			return ref, true
+		}
+	}
+	for _, issue := range v.issues {
+		ref := issue.Ref()
+		if v.texts[ref].contains(quote) {
+			return ref, true
+		}
+	}
+	return github.IssueRef{}, false
+}
+
+// contains reports whether enough of the quote appears in the text. Each
+// part of a quote elided with "..." is matched separately.
+func (t *sourceText) contains(quote string) bool {
+	matched, total := 0, 0
+	for _, fragment := range ellipsisRe.Split(quote, -1) {
+		words := normalizeWords(fragment)
+		if len(words) == 0 {
+			continue
+		}
+		if len(words) < quoteShingleWords {
+			total++
+			if strings.Contains(t.joined, " "+strings.Join(words, " ")+" ") {
+				matched++
+			}
+			continue
+		}
+		for shingle := range shingles(words) {
+			total++
+			if t.shingles[shingle] {
+				matched++
+			}
+		}
+	}
+	return total > 0 && float64(matched) >= minQuoteOverlap*float64(total)
+}
+
+// verifyQuotes checks a model's example and notable quotes against the
+// issues. Notable quotes found in a different issue than the one cited are
+// re-attributed. Unverified quotes are dropped when drop is set; otherwise
+// they are kept and notable quotes are marked as unverified. Examples in
+// checked are copies of quotes verified at an earlier stage and are skipped.
+func verifyQuotes(raw *rawAnalysis, v *quoteVerifier, drop bool, checked map[string]bool) {
+	stats := &raw.verification
+
+	for i := range raw.Themes {
+		theme := &raw.Themes[i]
+		theme.Examples = verifyExamples(theme.Examples, theme.Refs, v, drop, checked, stats)
+		theme.ExampleQuotes = verifyExamples(theme.ExampleQuotes, theme.Refs, v, drop, checked, stats)
+	}
+
+	var quotes []rawQuote
+	for _, q := range raw.NotableQuotes {
+		if q.checked {
+			quotes = append(quotes, q)
+			continue
+		}
+
+		q.checked = true
+		stats.Quotes++
+		var preferred []github.IssueRef
+		if q.Ref != nil {
+			preferred = []github.IssueRef{*q.Ref}
+		}
+		if ref, ok := v.find(q.Text, preferred); ok {
+			q.Ref = &ref
+			q.Verified = true
+			stats.VerifiedQuotes++
+		} else if drop {
+			stats.DroppedQuotes++
+			continue
+		}
+		quotes = append(quotes, q)
+	}
+	raw.NotableQuotes = quotes
+}
+
+func verifyExamples(examples []string, refs []github.IssueRef, v *quoteVerifier, drop bool,
+	checked map[string]bool, stats *Verification) []string {
+	var kept []string
+	for _, example := range examples {
+		if checked[example] {
+			kept = append(kept, example)
+			continue
+		}
+
+		stats.Quotes++
+		if _, ok := v.find(example, refs); ok {
+			stats.VerifiedQuotes++
+		} else if drop {
+			stats.DroppedQuotes++
+			continue
+		}
+		kept = append(kept, example)
+	}
+	return kept
+}
+
+// checkedExamples collects the examples of analyses that were already verified.
+func checkedExamples(analyses []*rawAnalysis) map[string]bool {
+	checked := make(map[string]bool)
+	for _, a := range analyses {
+		for _, theme := range a.Themes {
+			for _, example := range theme.Examples {
+				checked[example] = true
+			}
+			for _, example := range theme.ExampleQuotes {
+				checked[example] = true
+			}
+		}
+	}
+	return checked
+}
+
+func normalizeWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func shingles(words []string) map[string]bool {
+	set := make(map[string]bool)
+	for i := 0; i+quoteShingleWords <= len(words); i++ {
+		set[strings.Join(words[i:i+quoteShingleWords], " ")] = true
+	}
+	return set
+}
@@ -0,0 +1,250 @@
+// Package config loads analysis definitions from a YAML or JSON file, so
+// runs can be version-controlled and mounted into a job instead of spelled
+// out as flags.
+//
+// String values may reference environment variables as ${NAME} or
+// ${NAME:-default}, which keeps secrets out of the file; $${ escapes a
+// literal "${".
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is a run definition. Unset fields keep the CLI defaults; numbers
+// and booleans are pointers so an explicit zero can be told from unset.
+type Config struct {
+	Repos       []Repo   `yaml:"repos"`
+	Labels      []string `yaml:"labels"`   // for repos without their own
+	Keywords    []string `yaml:"keywords"` // for repos without their own
+	Kind        string   `yaml:"kind"`
+	MaxIssues   *int     `yaml:"max_issues"`
+	Comments    *bool    `yaml:"comments"`
+	MaxComments *int     `yaml:"max_comments"`
+	StoreDir    string   `yaml:"store_dir"`
+
+	LLM      LLM      `yaml:"llm"`
+	Sampling Sampling `yaml:"sampling"`
+	Prompts  Prompts  `yaml:"prompts"`
+	Analysis Analysis `yaml:"analysis"`
+	Cache    Cache    `yaml:"cache"`
+	Output   Output   `yaml:"output"`
+	Pricing  Pricing  `yaml:"pricing"`
+
+	Profiles []Profile `yaml:"profiles"`
+}
+
+// Repo is a repository to analyze, either "owner/repo" or a mapping with
+// its own labels and keywords.
+type Repo struct {
+	Name     string   `yaml:"name"`
+	Labels   []string `yaml:"labels"`
+	Keywords []string `yaml:"keywords"`
+}
+
+func (r *Repo) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		r.Name = node.Value
+		return nil
+	}
+	type plain Repo // without this method
+	return node.Decode((*plain)(r))
+}
+
+type LLM struct {
+	Provider         string            `yaml:"provider"`
+	Endpoint         string            `yaml:"endpoint"`
+	Model            string            `yaml:"model"`
+	APIKey           string            `yaml:"api_key"` // usually "${SOME_ENV_VAR}"
+	APIKeyEnv        string            `yaml:"api_key_env"`
+	APIKeyFile       string            `yaml:"api_key_file"`
+	Headers          map[string]string `yaml:"headers"`
+	ClientCert       string            `yaml:"client_cert"`
+	ClientKey        string            `yaml:"client_key"`
+	CACert           string            `yaml:"ca_cert"`
+	Retries          *int              `yaml:"retries"`
+	RequestTimeout   *time.Duration    `yaml:"request_timeout"`
+	BreakerThreshold *int              `yaml:"breaker_threshold"`
+	StructuredOutput string            `yaml:"structured_output"`
+	Stream           *bool             `yaml:"stream"`
+	Concurrency      *int              `yaml:"concurrency"`
+	ContextWindow    *int              `yaml:"context_window"`
+}
+
+// Sampling holds the profiles of the two sampling stages.
+type Sampling struct {
+	Batch     SamplingProfile `yaml:"batch"`
+	Synthesis SamplingProfile `yaml:"synthesis"`
+}
+
+type SamplingProfile struct {
+	Temperature     *float64 `yaml:"temperature"`
+	TopP            *float64 `yaml:"top_p"`
+	RepeatPenalty   *float64 `yaml:"repeat_penalty"`
+	PresencePenalty *float64 `yaml:"presence_penalty"`
+	Seed            *int     `yaml:"seed"`
+	Stop            []string `yaml:"stop"`
+}
+
+// Profile is a named analysis of the fetched issues. Each profile analyzes
+// the issues matching its filters with its own focus areas and prompts, and
+// gets a section of the report, or a report file of its own.
+type Profile struct {
+	Name     string   `yaml:"name"`
+	Focus    []string `yaml:"focus"`    // focus areas, the fetched keywords if empty
+	Labels   []string `yaml:"labels"`   // issues with all of these labels
+	Keywords []string `yaml:"keywords"` // issues mentioning any of these
+	Prompts  Prompts  `yaml:"prompts"`  // on top of the top-level prompts
+	Title    string   `yaml:"title"`
+	Report   string   `yaml:"report"` // own report file instead of a section
+}
+
+// Prompts replaces the system prompts of analysis stages.
+type Prompts struct {
+	Batch          string `yaml:"batch"`
+	Merge          string `yaml:"merge"`
+	Synthesis      string `yaml:"synthesis"`
+	Classify       string `yaml:"classify"`
+	ClusterNaming  string `yaml:"cluster_naming"`
+	ClusterSummary string `yaml:"cluster_summary"`
+}
+
+type Analysis struct {
+	Strategy             string   `yaml:"strategy"`
+	Classify             *bool    `yaml:"classify"`
+	EmbeddingModel       string   `yaml:"embedding_model"`
+	ClusterThreshold     *float64 `yaml:"cluster_threshold"`
+	MinClusterSize       *int     `yaml:"min_cluster_size"`
+	MaxPromptTokens      *int     `yaml:"max_prompt_tokens"`
+	MaxBatchIssues       *int     `yaml:"max_batch_issues"`
+	MaxRepairAttempts    *int     `yaml:"max_repair_attempts"`
+	DropUnverifiedQuotes *bool    `yaml:"drop_unverified_quotes"`
+	Verbose              *bool    `yaml:"verbose"`
+}
+
+type Cache struct {
+	Dir       string         `yaml:"dir"`
+	TTL       *time.Duration `yaml:"ttl"`
+	MaxSizeMB *int64         `yaml:"max_size_mb"`
+	Disabled  *bool          `yaml:"disabled"`
+	Refresh   *bool          `yaml:"refresh"`
+}
+
+// Output names the files each stage writes.
+type Output struct {
+	Dataset     string `yaml:"dataset"`  // written by fetch, read by analyze
+	Analysis    string `yaml:"analysis"` // written by analyze, read by report
+	Report      string `yaml:"report"`
+	Format      string `yaml:"format"`
+	Title       string `yaml:"title"`
+	ClassifyCSV string `yaml:"classify_csv"`
+}
+
+type Pricing struct {
+	PromptPer1K     *float64 `yaml:"prompt_per_1k"`
+	CompletionPer1K *float64 `yaml:"completion_per_1k"`
+}
+
+// Load reads a config file, expanding environment variables in its string
+// values. Unknown keys are an error so typos do not go unnoticed.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("parse config %s: %w", path, err)
+	}
+	expandNode(&root)
+
+	// Decode the expanded tree strictly; yaml.Node.Decode cannot reject
+	// unknown keys, so go through the encoded form
+	expanded, err := yaml.Marshal(&root)
+	if err != nil {
+		return nil, fmt.Errorf("parse config %s: %w", path, err)
+	}
+	var cfg Config
+	dec := yaml.NewDecoder(bytes.NewReader(expanded))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("parse config %s: %w", path, err)
+	}
+
+	for i, repo := range cfg.Repos {
+		if parts := strings.Split(repo.Name, "/"); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("config %s: repos[%d]: invalid repo %q (expected owner/repo)", path, i, repo.Name)
+		}
+	}
+	names := make(map[string]bool)
+	for i, profile := range cfg.Profiles {
+		if profile.Name == "" {
+			return nil, fmt.Errorf("config %s: profiles[%d]: missing name", path, i)
+		}
+		if names[profile.Name] {
+			return nil, fmt.Errorf("config %s: profiles[%d]: duplicate name %q", path, i, profile.Name)
+		}
+		names[profile.Name] = true
+	}
+	return &cfg, nil
+}
+
+// RepoNames returns the configured repositories as "owner/repo".
+func (c *Config) RepoNames() []string {
+	names := make([]string, len(c.Repos))
+	for i, repo := range c.Repos {
+		names[i] = repo.Name
+	}
+	return names
+}
+
+// Repo returns the settings of the named repository, if it is configured.
+func (c *Config) Repo(name string) (Repo, bool) {
+	for _, repo := range c.Repos {
+		if strings.EqualFold(repo.Name, name) {
+			return repo, true
+		}
+	}
+	return Repo{}, false
+}
+
+func expandNode(node *yaml.Node) {
+	if node.Kind == yaml.ScalarNode && node.Tag != "!!binary" {
+		if expanded := expandEnv(node.Value); expanded != node.Value {
+			node.Value = expanded
+			if node.Style == 0 {
+				node.Tag = "" // resolve the expanded value, e.g. "${MAX_ISSUES}" as a number
+			}
+		}
+		return
+	}
+	for _, child := range node.Content {
+		expandNode(child)
+	}
+}
+
+var envRef = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandEnv replaces ${NAME} and ${NAME:-default} with environment
+// variables. Unlike os.ExpandEnv it leaves bare $NAME alone, since prompts
+// and headers may contain dollar signs.
+func expandEnv(s string) string {
+	return envRef.ReplaceAllStringFunc(s, func(ref string) string {
+		if strings.HasPrefix(ref, "$$") {
+			return ref[1:]
+		}
+		m := envRef.FindStringSubmatch(ref)
+		if value, ok := os.LookupEnv(m[1]); ok && value != "" {
+			return value
+		}
+		return m[3]
+	})
+}
@@ -7,6 +7,7 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -27,7 +28,73 @@ type Issue struct {
 	UpdatedAt time.Time `json:"updated_at"`
 	HTMLURL   string    `json:"html_url"`
 	Comments  int       `json:"comments"`
-	Repo      string    `json:"-"` // Added by us
+	Repo      string    `json:"repo,omitempty"`   // Added by us
+	Thread    []Comment `json:"thread,omitempty"` // Fetched separately when FetchOptions.IncludeComments is set
+
+	// PullRequest is only present when the item is a pull request; the
+	// issues API returns both.
+	PullRequest *PullRequestLink `json:"pull_request,omitempty"`
+}
+
+type PullRequestLink struct {
+	URL     string `json:"url"`
+	HTMLURL string `json:"html_url"`
+}
+
+// IsPullRequest reports whether the item is a pull request rather than an issue.
+func (i Issue) IsPullRequest() bool {
+	return i.PullRequest != nil
+}
+
+type Comment struct {
+	Body      string    `json:"body"`
+	User      User      `json:"user"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type User struct {
+	Login string `json:"login"`
+}
+
+// IssueRef identifies an issue across repositories, e.g. "ollama/ollama#1234".
+type IssueRef struct {
+	Repo   string `json:"repo"`
+	Number int    `json:"number"`
+}
+
+func (r IssueRef) String() string {
+	return fmt.Sprintf("%s#%d", r.Repo, r.Number)
+}
+
+// URL returns the GitHub web URL of the issue.
+func (r IssueRef) URL() string {
+	return fmt.Sprintf("https://github.com/%s/issues/%d", r.Repo, r.Number)
+}
+
+// ParseIssueRef parses an "owner/repo#number" reference.
+func ParseIssueRef(s string) (IssueRef, error) {
+	s = strings.TrimSpace(s)
+	idx := strings.LastIndex(s, "#")
+	if idx <= 0 {
+		return IssueRef{}, fmt.Errorf("invalid issue reference %q (expected owner/repo#number)", s)
+	}
+
+	repo := s[:idx]
+	if parts := strings.Split(repo, "/"); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return IssueRef{}, fmt.Errorf("invalid repo in issue reference %q", s)
+	}
+
+	number, err := strconv.Atoi(s[idx+1:])
+	if err != nil || number <= 0 {
+		return IssueRef{}, fmt.Errorf("invalid issue number in reference %q", s)
+	}
+
+	return IssueRef{Repo: repo, Number: number}, nil
+}
+
+// Ref returns the repo-qualified reference for the issue.
+func (i Issue) Ref() IssueRef {
+	return IssueRef{Repo: i.Repo, Number: i.Number}
 }
 
 type Label struct {
@@ -37,37 +104,115 @@ type Label struct {
 type FetchOptions struct {
 	Labels   []string
 	Keywords []string
-	MaxItems int
-	State    string // "open", "closed", "all"
+	MaxItems int       // 0 fetches every matching item
+	State    string    // "open", "closed", "all"
+	Since    time.Time // only items updated at or after this time, if set
+
+	IncludeComments bool // fetch each issue's comment thread
+	MaxComments     int  // per-issue cap on fetched comments (default 10)
+
+	Kind ItemKind // issues (default), pull requests or both
 }
 
+// ItemKind selects whether issues, pull requests or both are fetched.
+type ItemKind string
+
+const (
+	KindIssues       ItemKind = "issues"
+	KindPullRequests ItemKind = "prs"
+	KindAll          ItemKind = "all"
+)
+
+// ParseItemKind validates a kind name; an empty name means KindIssues.
+func ParseItemKind(s string) (ItemKind, error) {
+	switch kind := ItemKind(strings.ToLower(strings.TrimSpace(s))); kind {
+	case "":
+		return KindIssues, nil
+	case KindIssues, KindPullRequests, KindAll:
+		return kind, nil
+	default:
+		return "", fmt.Errorf("invalid kind %q (expected issues, prs or all)", s)
+	}
+}
+
+// Matches reports whether an item should be kept for this kind.
+func (k ItemKind) Matches(issue Issue) bool {
+	switch k {
+	case KindAll:
+		return true
+	case KindPullRequests:
+		return issue.IsPullRequest()
+	default:
+		return !issue.IsPullRequest()
+	}
+}
+
+// qualifier returns the search API qualifier for this kind.
+func (k ItemKind) qualifier() string {
+	switch k {
+	case KindAll:
+		return ""
+	case KindPullRequests:
+		return " is:pr"
+	default:
+		return " is:issue"
+	}
+}
+
+const defaultMaxComments = 10
+
 func NewClient(token string) *Client {
 	return &Client{
-		httpClient: &http.Client{Timeout: 30 * time.Second},
+		// Timeouts are applied per attempt by the transport so retries and
+		// rate limit waits are bounded only by the caller's context
+		httpClient: &http.Client{Transport: newRetryTransport(http.DefaultTransport)},
 		token:      token,
 		baseURL:    "https://api.github.com",
 	}
 }
 
 func (c *Client) FetchIssues(ctx context.Context, owner, repo string, opts FetchOptions) ([]Issue, error) {
-	var allIssues []Issue
+	var issues []Issue
+	var err error
 
 	// Use search API for keyword filtering
 	if len(opts.Keywords) > 0 {
-		return c.searchIssues(ctx, owner, repo, opts)
+		issues, err = c.searchIssues(ctx, owner, repo, opts)
+	} else {
+		issues, err = c.listIssues(ctx, owner, repo, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.IncludeComments {
+		if err := c.fetchThreads(ctx, owner, repo, issues, opts); err != nil {
+			return nil, err
+		}
 	}
 
-	// Otherwise use the standard issues API
+	return issues, nil
+}
+
+func (c *Client) listIssues(ctx context.Context, owner, repo string, opts FetchOptions) ([]Issue, error) {
+	var allIssues []Issue
+
+	// Otherwise use the standard issues API. It returns pull requests too, so
+	// pages are filtered by kind and only shrunk when nothing is filtered out.
 	page := 1
 	perPage := 100
-	if opts.MaxItems < perPage {
+	if opts.MaxItems > 0 && opts.MaxItems < perPage && opts.Kind == KindAll {
 		perPage = opts.MaxItems
 	}
 
-	for len(allIssues) < opts.MaxItems {
+	for opts.MaxItems <= 0 || len(allIssues) < opts.MaxItems {
 		endpoint := fmt.Sprintf("%s/repos/%s/%s/issues?page=%d&per_page=%d&state=%s",
 			c.baseURL, owner, repo, page, perPage, opts.State)
 
+		if !opts.Since.IsZero() {
+			endpoint += "&since=" + url.QueryEscape(opts.Since.UTC().Format(time.RFC3339))
+		}
+
 		if len(opts.Labels) > 0 && opts.Labels[0] != "" {
 			endpoint += "&labels=" + url.QueryEscape(strings.Join(opts.Labels, ","))
 		}
@@ -81,11 +226,12 @@ func (c *Client) FetchIssues(ctx context.Context, owner, repo string, opts Fetch
 			break
 		}
 
-		for i := range issues {
-			issues[i].Repo = fmt.Sprintf("%s/%s", owner, repo)
+		for _, issue := range issues {
+			if opts.Kind.Matches(issue) {
+				issue.Repo = fmt.Sprintf("%s/%s", owner, repo)
+				allIssues = append(allIssues, issue)
+			}
 		}
-
-		allIssues = append(allIssues, issues...)
 		page++
 
 		if len(issues) < perPage {
@@ -93,7 +239,7 @@ func (c *Client) FetchIssues(ctx context.Context, owner, repo string, opts Fetch
 		}
 	}
 
-	if len(allIssues) > opts.MaxItems {
+	if opts.MaxItems > 0 && len(allIssues) > opts.MaxItems {
 		allIssues = allIssues[:opts.MaxItems]
 	}
 
@@ -111,21 +257,23 @@ func (c *Client) searchIssues(ctx context.Context, owner, repo string, opts Fetc
 			continue
 		}
 
-		query := fmt.Sprintf("%s repo:%s/%s is:issue", keyword, owner, repo)
+		query := fmt.Sprintf("%s repo:%s/%s%s", keyword, owner, repo, opts.Kind.qualifier())
 		if opts.State != "" && opts.State != "all" {
 			query += " state:" + opts.State
 		}
+		if !opts.Since.IsZero() {
+			query += " updated:>=" + opts.Since.UTC().Format(time.RFC3339)
+		}
 
 		page := 1
-		for len(allIssues) < opts.MaxItems {
+		for opts.MaxItems <= 0 || len(allIssues) < opts.MaxItems {
 			endpoint := fmt.Sprintf("%s/search/issues?q=%s&page=%d&per_page=100",
 				c.baseURL, url.QueryEscape(query), page)
 
 			result, err := c.fetchSearchPage(ctx, endpoint)
 			if err != nil {
-				// Rate limit or other error, continue with what we have
-				fmt.Printf("    Warning: search error for '%s': %v\n", keyword, err)
-				break
+				// Retries are exhausted, so don't return partial results
+				return nil, fmt.Errorf("search %q: %w", keyword, err)
 			}
 
 			if len(result.Items) == 0 {
@@ -157,100 +305,101 @@ func (c *Client) searchIssues(ctx context.Context, owner, repo string, opts Fetc
 		}
 	}
 
-	if len(allIssues) > opts.MaxItems {
+	if opts.MaxItems > 0 && len(allIssues) > opts.MaxItems {
 		allIssues = allIssues[:opts.MaxItems]
 	}
 
 	return allIssues, nil
 }
 
-type searchResult struct {
-	Items []Issue `json:"items"`
-	Total int     `json:"total_count"`
-}
-
-func (c *Client) fetchSearchPage(ctx context.Context, endpoint string) (*searchResult, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
-	if err != nil {
-		return nil, err
+// fetchThreads loads up to opts.MaxComments comments for each issue that has any.
+func (c *Client) fetchThreads(ctx context.Context, owner, repo string, issues []Issue, opts FetchOptions) error {
+	maxComments := opts.MaxComments
+	if maxComments <= 0 {
+		maxComments = defaultMaxComments
 	}
 
-	req.Header.Set("Accept", "application/vnd.github+json")
-	req.Header.Set("User-Agent", "IssueParser/1.0") // GitHub requires User-Agent
-	if c.token != "" {
-		req.Header.Set("Authorization", "Bearer "+c.token)
-	}
+	for i := range issues {
+		if issues[i].Comments == 0 {
+			continue
+		}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer func() { _ = resp.Body.Close() }()
+		perPage := maxComments
+		if perPage > 100 {
+			perPage = 100
+		}
 
-	// Check rate limit headers
-	if remaining := resp.Header.Get("X-RateLimit-Remaining"); remaining != "" {
-		if remaining == "0" {
-			resetTime := resp.Header.Get("X-RateLimit-Reset")
-			return nil, fmt.Errorf("rate limited, resets at %s", resetTime)
+		var thread []Comment
+		for page := 1; len(thread) < maxComments; page++ {
+			endpoint := fmt.Sprintf("%s/repos/%s/%s/issues/%d/comments?page=%d&per_page=%d",
+				c.baseURL, owner, repo, issues[i].Number, page, perPage)
+
+			var comments []Comment
+			if err := c.getJSON(ctx, endpoint, &comments); err != nil {
+				return fmt.Errorf("fetch comments for #%d: %w", issues[i].Number, err)
+			}
+
+			thread = append(thread, comments...)
+			if len(comments) < perPage {
+				break
+			}
 		}
-	}
 
-	if resp.StatusCode == 403 {
-		return nil, fmt.Errorf("rate limited or forbidden")
+		if len(thread) > maxComments {
+			thread = thread[:maxComments]
+		}
+		issues[i].Thread = thread
 	}
 
-	if resp.StatusCode != 200 {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API error %d: %s", resp.StatusCode, string(body))
-	}
+	return nil
+}
 
+type searchResult struct {
+	Items []Issue `json:"items"`
+	Total int     `json:"total_count"`
+}
+
+func (c *Client) fetchSearchPage(ctx context.Context, endpoint string) (*searchResult, error) {
 	var result searchResult
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+	if err := c.getJSON(ctx, endpoint, &result); err != nil {
 		return nil, err
 	}
-
 	return &result, nil
 }
 
 func (c *Client) fetchPage(ctx context.Context, endpoint string) ([]Issue, error) {
+	var issues []Issue
+	if err := c.getJSON(ctx, endpoint, &issues); err != nil {
+		return nil, err
+	}
+	return issues, nil
+}
+
+// getJSON performs an authenticated GET against the GitHub API and decodes
+// the JSON response into v.
+func (c *Client) getJSON(ctx context.Context, endpoint string, v any) error {
 	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	req.Header.Set("Accept", "application/vnd.github+json")
-	req.Header.Set("User-Agent", "IssueParser/1.0")
+	req.Header.Set("User-Agent", "IssueParser/1.0") // GitHub requires User-Agent
 	if c.token != "" {
 		req.Header.Set("Authorization", "Bearer "+c.token)
 	}
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer func() { _ = resp.Body.Close() }()
 
-	// Check rate limit headers
-	if remaining := resp.Header.Get("X-RateLimit-Remaining"); remaining != "" {
-		if remaining == "0" {
-			resetTime := resp.Header.Get("X-RateLimit-Reset")
-			return nil, fmt.Errorf("rate limited, resets at %s", resetTime)
-		}
-	}
-
-	if resp.StatusCode == 403 {
-		return nil, fmt.Errorf("rate limited or forbidden")
-	}
-
+	// Rate limits and transient errors were already retried by the transport
 	if resp.StatusCode != 200 {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API error %d: %s", resp.StatusCode, string(body))
+		return fmt.Errorf("API error %d: %s", resp.StatusCode, string(body))
 	}
 
-	var issues []Issue
-	if err := json.NewDecoder(resp.Body).Decode(&issues); err != nil {
-		return nil, err
-	}
-
-	return issues, nil
+	return json.NewDecoder(resp.Body).Decode(v)
 }
@@ -0,0 +1,232 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/defilan/issueparser/internal/httpretry"
+)
+
+const (
+	defaultMaxRetries     = 5
+	defaultAttemptTimeout = 30 * time.Second
+	baseRetryDelay        = 1 * time.Second
+	maxRetryDelay         = 1 * time.Minute
+	secondaryLimitDelay   = 1 * time.Minute // GitHub's advice when no Retry-After is sent
+)
+
+// retryTransport retries GitHub API requests that hit rate limits or
+// transient failures. It waits for X-RateLimit-Reset and Retry-After,
+// backs off with jitter on 5xx and network errors, and gives up early when a
+// wait would outlast the request context's deadline.
+type retryTransport struct {
+	base           http.RoundTripper
+	maxRetries     int
+	attemptTimeout time.Duration
+
+	mu       sync.Mutex
+	resumeAt map[string]time.Time // per rate limit resource ("core", "search")
+}
+
+func newRetryTransport(base http.RoundTripper) *retryTransport {
+	return &retryTransport{
+		base:           base,
+		maxRetries:     defaultMaxRetries,
+		attemptTimeout: defaultAttemptTimeout,
+		resumeAt:       make(map[string]time.Time),
+	}
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	resource := rateLimitResource(req)
+
+	for attempt := 0; ; attempt++ {
+		if err := t.waitForReset(ctx, resource); err != nil {
+			return nil, err
+		}
+
+		resp, err := t.attempt(req)
+		wait, retry := t.retryAfter(ctx, resp, err, resource, attempt)
+		if !retry || attempt >= t.maxRetries {
+			return resp, err
+		}
+
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+
+		reason := "request failed"
+		if err == nil {
+			reason = fmt.Sprintf("GitHub API returned %d", resp.StatusCode)
+		}
+		fmt.Printf("    %s, retrying in %s (retry %d/%d)...\n", reason, wait.Round(time.Second), attempt+1, t.maxRetries)
+
+		if err := sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// attempt sends a single request with its own timeout. The timeout stays
+// active until the response body is closed.
+func (t *retryTransport) attempt(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), t.attemptTimeout)
+	resp, err := t.base.RoundTrip(req.Clone(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// retryAfter decides whether a response should be retried and how long to
+// wait first. It also records exhausted rate limits so later requests wait.
+func (t *retryTransport) retryAfter(ctx context.Context, resp *http.Response, err error,
+	resource string, attempt int) (time.Duration, bool) {
+	if err != nil {
+		// Network errors and attempt timeouts are retried, cancellation is not
+		if ctx.Err() != nil {
+			return 0, false
+		}
+		return backoff(attempt), true
+	}
+
+	reset := rateLimitReset(resp)
+	if resp.StatusCode == http.StatusOK {
+		if !reset.IsZero() {
+			t.setResumeAt(resource, reset)
+		}
+		return 0, false
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests:
+		if d, ok := httpretry.ParseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			return d, true
+		}
+		if !reset.IsZero() {
+			t.setResumeAt(resource, reset)
+			return time.Until(reset), true
+		}
+		if isSecondaryRateLimit(resp) {
+			return secondaryLimitDelay << attempt, true
+		}
+		// Plain permission error
+		return 0, false
+	case resp.StatusCode >= 500:
+		return backoff(attempt), true
+	default:
+		return 0, false
+	}
+}
+
+// waitForReset blocks until an exhausted rate limit for the resource resets.
+func (t *retryTransport) waitForReset(ctx context.Context, resource string) error {
+	t.mu.Lock()
+	resumeAt := t.resumeAt[resource]
+	t.mu.Unlock()
+
+	wait := time.Until(resumeAt)
+	if wait <= 0 {
+		return nil
+	}
+
+	fmt.Printf("    GitHub %s rate limit exhausted, waiting %s until reset...\n", resource, wait.Round(time.Second))
+	return sleep(ctx, wait)
+}
+
+func (t *retryTransport) setResumeAt(resource string, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.resumeAt[resource] = at
+}
+
+// rateLimitReset returns when the rate limit resets if the response shows
+// it as exhausted, or the zero time otherwise.
+func rateLimitReset(resp *http.Response) time.Time {
+	if resp.Header.Get("X-RateLimit-Remaining") != "0" {
+		return time.Time{}
+	}
+	epoch, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	// Add a second of slack for clock skew
+	return time.Unix(epoch, 0).Add(time.Second)
+}
+
+// isSecondaryRateLimit checks the error message of a 403/429 response. The
+// body is restored so callers can still read it.
+func isSecondaryRateLimit(resp *http.Response) bool {
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body = &replayBody{Reader: bytes.NewReader(body), closer: resp.Body}
+	return strings.Contains(strings.ToLower(string(body)), "secondary rate limit")
+}
+
+// rateLimitResource maps a request to the GitHub rate limit bucket it uses.
+func rateLimitResource(req *http.Request) string {
+	if strings.HasPrefix(req.URL.Path, "/search/") {
+		return "search"
+	}
+	return "core"
+}
+
+// backoff returns an exponential delay, jittered between half and full length.
+func backoff(attempt int) time.Duration {
+	d := baseRetryDelay << attempt
+	if d <= 0 || d > maxRetryDelay {
+		d = maxRetryDelay
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// sleep waits for d, failing fast if the context would expire first.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Now().Add(d).After(deadline) {
+		return fmt.Errorf("waiting %s for GitHub API would exceed the deadline", d.Round(time.Second))
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+type replayBody struct {
+	io.Reader
+	closer io.Closer
+}
+
+func (b *replayBody) Close() error {
+	return b.closer.Close()
+}
@@ -0,0 +1,24 @@
+// Package httpretry holds the HTTP retry helpers shared by the GitHub and
+// LLM clients.
+package httpretry
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ParseRetryAfter reads a Retry-After header, given either in seconds or as
+// an HTTP date. ok is false if the header is missing or malformed.
+func ParseRetryAfter(value string) (d time.Duration, ok bool) {
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		return time.Duration(secs) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return time.Until(at), true
+	}
+	return 0, false
+}
@@ -0,0 +1,35 @@
+package httpretry
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"seconds", "120", 2 * time.Minute, true},
+		{"zero", "0", 0, true},
+		{"http date", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), time.Hour, true},
+		{"missing", "", 0, false},
+		{"malformed", "soon", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseRetryAfter(tt.value)
+			if ok != tt.wantOK {
+				t.Fatalf("ParseRetryAfter(%q) ok = %v, want %v", tt.value, ok, tt.wantOK)
+			}
+			// HTTP dates have second precision
+			if diff := got - tt.want; diff < -2*time.Second || diff > 2*time.Second {
+				t.Errorf("ParseRetryAfter(%q) = %s, want %s", tt.value, got, tt.want)
+			}
+		})
+	}
+}
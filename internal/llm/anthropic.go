@@ -0,0 +1,157 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	anthropicVersion          = "2023-06-01"
+	anthropicDefaultMaxTokens = 1024 // max_tokens is required by the Messages API
+)
+
+// AnthropicClient talks to the Anthropic Messages API (/v1/messages).
+// Schemas are enforced by forcing a tool call whose input is the schema,
+// and the tool input is returned as the message content.
+type AnthropicClient struct {
+	*requester
+	model string
+}
+
+type anthropicRequest struct {
+	Model       string             `json:"model"`
+	System      string             `json:"system,omitempty"`
+	Messages    []Message          `json:"messages"`
+	MaxTokens   int                `json:"max_tokens"`
+	Temperature *float64           `json:"temperature,omitempty"`
+	TopP        float64            `json:"top_p,omitempty"`
+	Stop        []string           `json:"stop_sequences,omitempty"`
+	Tools       []anthropicTool    `json:"tools,omitempty"`
+	ToolChoice  *anthropicToolPick `json:"tool_choice,omitempty"`
+}
+
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+type anthropicToolPick struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+type anthropicResponse struct {
+	ID         string                  `json:"id"`
+	Content    []anthropicContentBlock `json:"content"`
+	StopReason string                  `json:"stop_reason"`
+	Usage      struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+}
+
+type anthropicContentBlock struct {
+	Type  string          `json:"type"` // "text" or "tool_use"
+	Text  string          `json:"text"`
+	Input json.RawMessage `json:"input"`
+}
+
+func NewAnthropicClient(endpoint, model string, opts Options) *AnthropicClient {
+	r := newRequester(endpoint, opts, func(h http.Header, apiKey string) {
+		h.Set("x-api-key", apiKey)
+	})
+	if r.header.Get("anthropic-version") == "" {
+		r.header.Set("anthropic-version", anthropicVersion)
+	}
+
+	return &AnthropicClient{
+		requester: r,
+		model:     model,
+	}
+}
+
+func (c *AnthropicClient) Model() string {
+	return c.model
+}
+
+func (c *AnthropicClient) Chat(ctx context.Context, messages []Message, opts CallOptions) (*ChatResponse, error) {
+	req := anthropicRequest{
+		Model:     c.model,
+		MaxTokens: opts.MaxTokens,
+	}
+	if req.MaxTokens <= 0 {
+		req.MaxTokens = anthropicDefaultMaxTokens
+	}
+
+	// The API accepts temperatures up to 1, rejects whitespace-only stop
+	// sequences and has no seed or repetition penalties. Some models reject
+	// temperature and top_p together, so top_p is only sent on its own.
+	sampling := opts.sampling()
+	if sampling.Temperature != nil {
+		req.Temperature = Float(min(*sampling.Temperature, 1))
+	} else {
+		req.TopP = sampling.TopP
+	}
+	for _, stop := range sampling.Stop {
+		if strings.TrimSpace(stop) != "" {
+			req.Stop = append(req.Stop, stop)
+		}
+	}
+
+	// System prompts are a top-level field rather than a message
+	var system []string
+	for _, m := range messages {
+		if m.Role == "system" {
+			system = append(system, m.Content)
+			continue
+		}
+		req.Messages = append(req.Messages, m)
+	}
+	req.System = strings.Join(system, "\n\n")
+
+	if opts.Schema != nil && c.structured != StructuredOff {
+		req.Tools = []anthropicTool{{
+			Name:        opts.Schema.Name,
+			Description: "Record the response in the required structure.",
+			InputSchema: opts.Schema.Definition,
+		}}
+		req.ToolChoice = &anthropicToolPick{Type: "tool", Name: opts.Schema.Name}
+	}
+
+	var resp anthropicResponse
+	if err := c.post(ctx, "/v1/messages", req, &resp); err != nil {
+		return nil, err
+	}
+
+	var content strings.Builder
+	for _, block := range resp.Content {
+		switch block.Type {
+		case "text":
+			content.WriteString(block.Text)
+		case "tool_use":
+			content.Write(block.Input)
+		}
+	}
+	if content.Len() == 0 && resp.StopReason != "max_tokens" {
+		return nil, fmt.Errorf("empty response (stop reason %q)", resp.StopReason)
+	}
+
+	finish := "stop"
+	if resp.StopReason == "max_tokens" {
+		finish = "length"
+	}
+
+	return &ChatResponse{
+		ID:      resp.ID,
+		Choices: []Choice{{Message: Message{Role: "assistant", Content: content.String()}, FinishReason: finish}},
+		Usage: Usage{
+			PromptTokens:     resp.Usage.InputTokens,
+			CompletionTokens: resp.Usage.OutputTokens,
+			TotalTokens:      resp.Usage.InputTokens + resp.Usage.OutputTokens,
+		},
+	}, nil
+}
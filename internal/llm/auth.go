@@ -0,0 +1,92 @@
+package llm
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// ReadAPIKey returns the API key from file if one is given, otherwise from
+// the environment variable envVar. Surrounding whitespace, such as the
+// trailing newline of a mounted secret, is removed.
+func ReadAPIKey(envVar, file string) (string, error) {
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("read API key: %w", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	if envVar == "" {
+		return "", nil
+	}
+	return strings.TrimSpace(os.Getenv(envVar)), nil
+}
+
+// ParseHeader parses a "Name: value" header.
+func ParseHeader(s string) (name, value string, err error) {
+	name, value, ok := strings.Cut(s, ":")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return "", "", fmt.Errorf("invalid header %q (expected \"Name: value\")", s)
+	}
+	return name, strings.TrimSpace(value), nil
+}
+
+// LoadTLSConfig builds a TLS config for mutual TLS. The client certificate
+// and key must be given together; caFile adds a CA for verifying the
+// server on top of the system roots. It returns nil when all are empty.
+func LoadTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	if certFile == "" && keyFile == "" && caFile == "" {
+		return nil, nil
+	}
+	if (certFile == "") != (keyFile == "") {
+		return nil, fmt.Errorf("client certificate and key must be given together")
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA certificate: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	return cfg, nil
+}
+
+// newHTTPClient returns an HTTP client that uses tlsConfig, if set. Without
+// a per-attempt requestTimeout, requests are limited to llmClientTimeout.
+func newHTTPClient(tlsConfig *tls.Config, requestTimeout time.Duration) *http.Client {
+	client := &http.Client{Timeout: llmClientTimeout}
+	if requestTimeout > 0 {
+		client.Timeout = 0 // the attempt context limits the request
+	}
+	if tlsConfig != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		client.Transport = transport
+	}
+	return client
+}
@@ -0,0 +1,265 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CacheOptions configures the on-disk response cache.
+type CacheOptions struct {
+	Dir     string
+	TTL     time.Duration // entries older than this are ignored; 0 never expires
+	MaxSize int64         // bytes; least recently used entries are evicted beyond it, 0 is unlimited
+	Refresh bool          // ignore existing entries but store new responses
+
+	// The setup of the wrapped provider, part of every key so responses
+	// are not shared between servers or structured output modes
+	Provider         string
+	Endpoint         string
+	StructuredOutput StructuredMode
+}
+
+// CacheStats counts cache lookups.
+type CacheStats struct {
+	Hits   int64
+	Misses int64
+}
+
+// CachedProvider answers repeated requests from an on-disk cache. Entries
+// are keyed by a hash of the provider setup, model, call options and
+// messages, so any change to a prompt or sampling profile misses.
+// Responses cut short by repetition are not cached.
+type CachedProvider struct {
+	Provider
+	opts CacheOptions
+
+	hits, misses atomic.Int64
+
+	sizeMu sync.Mutex
+	size   int64 // bytes in the cache, tracked only with a MaxSize
+}
+
+type cacheEntry struct {
+	Created    time.Time     `json:"created"`
+	Response   *ChatResponse `json:"response,omitempty"`
+	Embeddings [][]float64   `json:"embeddings,omitempty"`
+}
+
+// NewCachedProvider wraps p with a cache in opts.Dir, creating it if needed
+// and evicting entries beyond opts.MaxSize.
+func NewCachedProvider(p Provider, opts CacheOptions) (*CachedProvider, error) {
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create cache directory: %w", err)
+	}
+	c := &CachedProvider{Provider: p, opts: opts}
+	if opts.MaxSize > 0 {
+		c.sizeMu.Lock()
+		c.evict()
+		c.sizeMu.Unlock()
+	}
+	return c, nil
+}
+
+// Stats returns the lookups made so far.
+func (c *CachedProvider) Stats() CacheStats {
+	return CacheStats{Hits: c.hits.Load(), Misses: c.misses.Load()}
+}
+
+// Chat serves the response from the cache if an unexpired entry exists and
+// otherwise calls the wrapped provider, marking cached responses with Cached.
+func (c *CachedProvider) Chat(ctx context.Context, messages []Message, opts CallOptions) (*ChatResponse, error) {
+	key := c.key("chat", struct {
+		Model    string    `json:"model"`
+		Messages []Message `json:"messages"`
+		Max      int       `json:"max_tokens"`
+		Schema   *Schema   `json:"schema"`
+		Grammar  string    `json:"grammar"`
+		Sampling Sampling  `json:"sampling"`
+	}{c.Model(), messages, opts.MaxTokens, opts.Schema, opts.Grammar, opts.sampling()})
+
+	if entry, ok := c.load(key); ok && entry.Response != nil {
+		resp := *entry.Response
+		resp.Cached = true
+		return &resp, nil
+	}
+
+	resp, err := c.Provider.Chat(ctx, messages, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Choices) > 0 && resp.Choices[0].FinishReason != FinishRepetition {
+		c.store(key, cacheEntry{Response: resp})
+	}
+	return resp, nil
+}
+
+// Embed serves embeddings from the cache, failing if the wrapped provider
+// has no embeddings API.
+func (c *CachedProvider) Embed(ctx context.Context, model string, inputs []string) ([][]float64, error) {
+	embedder, ok := c.Provider.(Embedder)
+	if !ok {
+		return nil, fmt.Errorf("LLM provider does not support embeddings")
+	}
+	if model == "" {
+		model = c.Model()
+	}
+	key := c.key("embed", struct {
+		Model  string   `json:"model"`
+		Inputs []string `json:"inputs"`
+	}{model, inputs})
+
+	if entry, ok := c.load(key); ok && len(entry.Embeddings) == len(inputs) {
+		return entry.Embeddings, nil
+	}
+
+	vectors, err := embedder.Embed(ctx, model, inputs)
+	if err != nil {
+		return nil, err
+	}
+	c.store(key, cacheEntry{Embeddings: vectors})
+	return vectors, nil
+}
+
+func (c *CachedProvider) key(kind string, request any) string {
+	setup := struct {
+		Provider         string         `json:"provider"`
+		Endpoint         string         `json:"endpoint"`
+		StructuredOutput StructuredMode `json:"structured_output"`
+		Request          any            `json:"request"`
+	}{c.opts.Provider, c.opts.Endpoint, c.opts.StructuredOutput, request}
+	data, _ := json.Marshal(setup) // plain data, cannot fail
+	sum := sha256.Sum256(append([]byte(kind+"\n"), data...))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *CachedProvider) path(key string) string {
+	return filepath.Join(c.opts.Dir, key[:2], key+".json")
+}
+
+func (c *CachedProvider) load(key string) (*cacheEntry, bool) {
+	if c.opts.Refresh {
+		c.misses.Add(1)
+		return nil, false
+	}
+
+	path := c.path(key)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		c.misses.Add(1)
+		return nil, false
+	}
+
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil ||
+		(c.opts.TTL > 0 && time.Since(entry.Created) > c.opts.TTL) {
+		c.misses.Add(1)
+		return nil, false
+	}
+
+	// The modification time tracks last use for eviction
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+	c.hits.Add(1)
+	return &entry, true
+}
+
+// store saves an entry. Cache failures never fail a request, they only cost
+// a warning.
+func (c *CachedProvider) store(key string, entry cacheEntry) {
+	entry.Created = time.Now()
+	path := c.path(key)
+	var replaced int64
+	if info, err := os.Stat(path); err == nil {
+		replaced = info.Size()
+	}
+	written, err := c.write(path, entry)
+	if err != nil {
+		fmt.Printf("    Warning: caching response failed: %v\n", err)
+		return
+	}
+
+	if c.opts.MaxSize > 0 {
+		c.sizeMu.Lock()
+		defer c.sizeMu.Unlock()
+		c.size += written - replaced
+		if c.size > c.opts.MaxSize {
+			c.evict()
+		}
+	}
+}
+
+// write stores an entry atomically, so concurrent runs never read a
+// partial file, and returns its size.
+func (c *CachedProvider) write(path string, entry cacheEntry) (int64, error) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return 0, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	_, writeErr := tmp.Write(data)
+	closeErr := tmp.Close()
+	if err := errors.Join(writeErr, closeErr); err != nil {
+		_ = os.Remove(tmp.Name())
+		return 0, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		_ = os.Remove(tmp.Name())
+		return 0, err
+	}
+	return int64(len(data)), nil
+}
+
+// evict walks the cache, removes the least recently used entries until it
+// fits MaxSize and resets the tracked size, which also picks up entries
+// written by concurrent runs. The caller holds sizeMu.
+func (c *CachedProvider) evict() {
+
+	type file struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var files []file
+	var total int64
+	_ = filepath.WalkDir(c.opts.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(path) != ".json" {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		files = append(files, file{path: path, size: info.Size(), modTime: info.ModTime()})
+		total += info.Size()
+		return nil
+	})
+
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	for _, f := range files {
+		if total <= c.opts.MaxSize {
+			break
+		}
+		if os.Remove(f.path) == nil {
+			total -= f.size
+		}
+	}
+	c.size = total
+}
@@ -1,8 +1,8 @@
 package llm
 
 import (
-	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -10,21 +10,76 @@ import (
 	"time"
 )
 
+// Client talks to OpenAI-compatible servers (llama.cpp, vLLM, LLMKube,
+// OpenAI) via /v1/chat/completions and /v1/embeddings.
 type Client struct {
-	httpClient *http.Client
-	endpoint   string
-	model      string
+	*requester
+	model     string
+	streaming bool
+}
+
+type Options struct {
+	Retry          RetryPolicy   // zero value uses DefaultRetryPolicy
+	RequestTimeout time.Duration // per attempt, including streamed responses; 0 uses a 5 minute timeout
+
+	// BreakerThreshold is the number of consecutive failed requests after
+	// which calls fail fast with ErrCircuitOpen for BreakerCooldown. 0
+	// disables the breaker.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+
+	// StructuredOutput selects how response schemas are sent (default
+	// StructuredJSONSchema).
+	StructuredOutput StructuredMode
+
+	// APIKey is sent as a bearer token, or as x-api-key to Anthropic.
+	APIKey string
+	// Headers are added to every request, overriding the auth header if
+	// they set the same name.
+	Headers http.Header
+	// TLS configures client certificates and trusted CAs (see
+	// LoadTLSConfig); nil uses the system defaults.
+	TLS *tls.Config
+
+	// Stream requests responses as they are generated, which lets callers
+	// show progress and stops output that degenerates into repetition.
+	// Anthropic responses are never streamed.
+	Stream bool
+}
+
+// CallOptions are per-call settings for Chat and Complete.
+type CallOptions struct {
+	MaxTokens int
+	Schema    *Schema   // constrain the response to JSON matching this schema
+	Grammar   string    // llama.cpp GBNF grammar, sent as-is
+	Sampling  *Sampling // nil uses DefaultSampling
+
+	// OnProgress is called as a streamed response arrives, and once more
+	// with Done set when it is complete.
+	OnProgress func(StreamProgress)
 }
 
 type ChatRequest struct {
 	Model           string    `json:"model"`
 	Messages        []Message `json:"messages"`
 	MaxTokens       int       `json:"max_tokens,omitempty"`
-	Temperature     float64   `json:"temperature,omitempty"`
+	Temperature     *float64  `json:"temperature,omitempty"`
 	TopP            float64   `json:"top_p,omitempty"`
 	RepeatPenalty   float64   `json:"repeat_penalty,omitempty"`
 	Stop            []string  `json:"stop,omitempty"`
 	PresencePenalty float64   `json:"presence_penalty,omitempty"`
+	Seed            *int      `json:"seed,omitempty"`
+
+	Stream        bool           `json:"stream,omitempty"`
+	StreamOptions *StreamOptions `json:"stream_options,omitempty"`
+
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+	JSONSchema     json.RawMessage `json:"json_schema,omitempty"` // llama.cpp extension
+	Grammar        string          `json:"grammar,omitempty"`     // llama.cpp extension
+}
+
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
 }
 
 type Message struct {
@@ -36,6 +91,8 @@ type ChatResponse struct {
 	ID      string   `json:"id"`
 	Choices []Choice `json:"choices"`
 	Usage   Usage    `json:"usage"`
+
+	Cached bool `json:"-"` // served by CachedProvider
 }
 
 type Choice struct {
@@ -50,65 +107,112 @@ type Usage struct {
 	TotalTokens      int `json:"total_tokens"`
 }
 
-func NewClient(endpoint, model string) *Client {
+type EmbeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type EmbeddingResponse struct {
+	Data  []Embedding `json:"data"`
+	Usage Usage       `json:"usage"`
+}
+
+type Embedding struct {
+	Index     int       `json:"index"`
+	Embedding []float64 `json:"embedding"`
+}
+
+func NewClient(endpoint, model string, opts Options) *Client {
 	return &Client{
-		httpClient: &http.Client{Timeout: 5 * time.Minute}, // LLM calls can be slow
-		endpoint:   endpoint,
-		model:      model,
+		requester: newRequester(endpoint, opts, bearerAuth),
+		model:     model,
+		streaming: opts.Stream,
 	}
 }
 
-func (c *Client) Chat(ctx context.Context, messages []Message, maxTokens int) (*ChatResponse, error) {
+func (c *Client) Model() string {
+	return c.model
+}
+
+func (c *Client) Chat(ctx context.Context, messages []Message, opts CallOptions) (*ChatResponse, error) {
+	sampling := opts.sampling()
 	req := ChatRequest{
 		Model:           c.model,
 		Messages:        messages,
-		MaxTokens:       maxTokens,
-		Temperature:     0.7,                             // Higher temperature to avoid repetition
-		TopP:            0.9,                             // Nucleus sampling
-		RepeatPenalty:   1.15,                            // Penalize repetition (llama.cpp parameter)
-		PresencePenalty: 0.1,                             // Slight presence penalty
-		Stop:            []string{"```\n\n", "\n\n\n\n"}, // Stop on repeated newlines
+		MaxTokens:       opts.MaxTokens,
+		Temperature:     sampling.Temperature,
+		TopP:            sampling.TopP,
+		RepeatPenalty:   sampling.RepeatPenalty, // llama.cpp parameter
+		PresencePenalty: sampling.PresencePenalty,
+		Stop:            sampling.Stop,
+		Seed:            sampling.Seed,
 	}
+	c.applyFormat(&req, opts)
 
-	body, err := json.Marshal(req)
-	if err != nil {
-		return nil, fmt.Errorf("marshal request: %w", err)
+	if c.streaming {
+		req.Stream = true
+		req.StreamOptions = &StreamOptions{IncludeUsage: true}
+		return c.chatStream(ctx, req, opts)
 	}
 
-	url := fmt.Sprintf("%s/v1/chat/completions", c.endpoint)
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
-	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
+	var chatResp ChatResponse
+	if err := c.post(ctx, "/v1/chat/completions", req, &chatResp); err != nil {
+		return nil, err
 	}
 
-	httpReq.Header.Set("Content-Type", "application/json")
+	return &chatResp, nil
+}
 
-	resp, err := c.httpClient.Do(httpReq)
-	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
-	}
-	defer func() { _ = resp.Body.Close() }()
+type chatChunk struct {
+	Choices []struct {
+		Delta        Message `json:"delta"`
+		FinishReason string  `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *Usage `json:"usage"`
+}
 
-	if resp.StatusCode != 200 {
-		respBody, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("LLM API error %d: %s", resp.StatusCode, string(respBody))
-	}
+// chatStream reads a server-sent event stream of chat completion chunks.
+func (c *Client) chatStream(ctx context.Context, req ChatRequest, opts CallOptions) (*ChatResponse, error) {
+	var resp *ChatResponse
+	err := c.stream(ctx, "/v1/chat/completions", req, func(body io.Reader) error {
+		acc := newStreamAccumulator(opts.OnProgress)
+		var usage Usage
 
-	var chatResp ChatResponse
-	if err := json.NewDecoder(resp.Body).Decode(&chatResp); err != nil {
-		return nil, fmt.Errorf("decode response: %w", err)
-	}
+		err := readSSE(body, func(data []byte) error {
+			var chunk chatChunk
+			if err := json.Unmarshal(data, &chunk); err != nil {
+				return fmt.Errorf("decode stream chunk: %w", err)
+			}
+			if chunk.Usage != nil {
+				usage = *chunk.Usage
+			}
+			for _, choice := range chunk.Choices {
+				if choice.FinishReason != "" {
+					acc.finish = choice.FinishReason
+				}
+				if err := acc.add(choice.Delta.Content); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
 
-	return &chatResp, nil
+		resp = acc.response(usage)
+		return nil
+	})
+	return resp, err
 }
 
-func (c *Client) Complete(ctx context.Context, systemPrompt, userPrompt string, maxTokens int) (string, error) {
+func (c *Client) Complete(ctx context.Context, systemPrompt, userPrompt string, opts CallOptions) (string, error) {
 	messages := []Message{
 		{Role: "system", Content: systemPrompt},
 		{Role: "user", Content: userPrompt},
 	}
 
-	resp, err := c.Chat(ctx, messages, maxTokens)
+	resp, err := c.Chat(ctx, messages, opts)
 	if err != nil {
 		return "", err
 	}
@@ -120,22 +224,33 @@ func (c *Client) Complete(ctx context.Context, systemPrompt, userPrompt string,
 	return resp.Choices[0].Message.Content, nil
 }
 
-func (c *Client) HealthCheck(ctx context.Context) error {
-	url := fmt.Sprintf("%s/health", c.endpoint)
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return err
+// Embed returns one embedding vector per input, in input order. An empty
+// model uses the client's chat model.
+func (c *Client) Embed(ctx context.Context, model string, inputs []string) ([][]float64, error) {
+	if model == "" {
+		model = c.model
 	}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("health check failed: %w", err)
+	var embResp EmbeddingResponse
+	if err := c.post(ctx, "/v1/embeddings", EmbeddingRequest{Model: model, Input: inputs}, &embResp); err != nil {
+		return nil, err
 	}
-	defer func() { _ = resp.Body.Close() }()
 
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("unhealthy status: %d", resp.StatusCode)
+	if len(embResp.Data) != len(inputs) {
+		return nil, fmt.Errorf("got %d embeddings for %d inputs", len(embResp.Data), len(inputs))
 	}
 
-	return nil
+	vectors := make([][]float64, len(inputs))
+	for _, e := range embResp.Data {
+		if e.Index < 0 || e.Index >= len(inputs) {
+			return nil, fmt.Errorf("embedding index %d out of range", e.Index)
+		}
+		vectors[e.Index] = e.Embedding
+	}
+
+	return vectors, nil
+}
+
+func (c *Client) HealthCheck(ctx context.Context) error {
+	return c.get(ctx, "/health")
 }
@@ -0,0 +1,112 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestClientEmbed(t *testing.T) {
+	tests := []struct {
+		name      string
+		model     string
+		status    int
+		response  EmbeddingResponse
+		want      [][]float64
+		wantModel string
+		wantErr   bool
+	}{
+		{
+			name: "out of order indexes",
+			response: EmbeddingResponse{Data: []Embedding{
+				{Index: 1, Embedding: []float64{0, 1}},
+				{Index: 0, Embedding: []float64{1, 0}},
+			}},
+			want:      [][]float64{{1, 0}, {0, 1}},
+			wantModel: "chat-model",
+		},
+		{
+			name:  "embedding model",
+			model: "embed-model",
+			response: EmbeddingResponse{Data: []Embedding{
+				{Index: 0, Embedding: []float64{1}},
+				{Index: 1, Embedding: []float64{2}},
+			}},
+			want:      [][]float64{{1}, {2}},
+			wantModel: "embed-model",
+		},
+		{
+			name:      "missing embedding",
+			response:  EmbeddingResponse{Data: []Embedding{{Index: 0, Embedding: []float64{1}}}},
+			wantModel: "chat-model",
+			wantErr:   true,
+		},
+		{
+			name: "index out of range",
+			response: EmbeddingResponse{Data: []Embedding{
+				{Index: 0, Embedding: []float64{1}},
+				{Index: 2, Embedding: []float64{2}},
+			}},
+			wantModel: "chat-model",
+			wantErr:   true,
+		},
+		{
+			name:      "server error",
+			status:    http.StatusBadRequest,
+			wantModel: "chat-model",
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got EmbeddingRequest
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/v1/embeddings" {
+					http.NotFound(w, r)
+					return
+				}
+				if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+					t.Errorf("decode request: %v", err)
+				}
+				if tt.status != 0 {
+					http.Error(w, "bad request", tt.status)
+					return
+				}
+				_ = json.NewEncoder(w).Encode(tt.response)
+			}))
+			defer srv.Close()
+
+			client := NewClient(srv.URL, "chat-model", Options{Retry: RetryPolicy{MaxAttempts: 1}})
+			inputs := []string{"first", "second"}
+			vectors, err := client.Embed(context.Background(), tt.model, inputs)
+
+			if got.Model != tt.wantModel {
+				t.Errorf("request model = %q, want %q", got.Model, tt.wantModel)
+			}
+			if !reflect.DeepEqual(got.Input, inputs) {
+				t.Errorf("request input = %q, want %q", got.Input, inputs)
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Embed returned %v, want an error", vectors)
+				}
+				var apiErr *APIError
+				if tt.status != 0 && (!errors.As(err, &apiErr) || apiErr.StatusCode != tt.status) {
+					t.Errorf("error = %v, want an APIError with status %d", err, tt.status)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Embed: %v", err)
+			}
+			if !reflect.DeepEqual(vectors, tt.want) {
+				t.Errorf("vectors = %v, want %v", vectors, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// StructuredMode selects how a JSON schema is sent to the server.
+type StructuredMode string
+
+const (
+	// StructuredJSONSchema sends response_format {type: json_schema}, as
+	// supported by OpenAI, vLLM and recent llama.cpp servers.
+	StructuredJSONSchema StructuredMode = "json_schema"
+	// StructuredJSONObject sends response_format {type: json_object} with the
+	// schema attached, the form older llama.cpp servers understand.
+	StructuredJSONObject StructuredMode = "json_object"
+	// StructuredLlamaCpp sends llama.cpp's top-level json_schema field.
+	StructuredLlamaCpp StructuredMode = "llamacpp"
+	// StructuredOff relies on the prompt alone.
+	StructuredOff StructuredMode = "off"
+)
+
+// ParseStructuredMode validates a mode name; an empty name means
+// StructuredJSONSchema.
+func ParseStructuredMode(s string) (StructuredMode, error) {
+	switch mode := StructuredMode(s); mode {
+	case "":
+		return StructuredJSONSchema, nil
+	case StructuredJSONSchema, StructuredJSONObject, StructuredLlamaCpp, StructuredOff:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid structured output mode %q (expected json_schema, json_object, llamacpp or off)", s)
+	}
+}
+
+// Schema is a named JSON schema the response must match.
+type Schema struct {
+	Name       string
+	Definition json.RawMessage
+}
+
+type ResponseFormat struct {
+	Type       string          `json:"type"` // "json_object" or "json_schema"
+	JSONSchema *JSONSchemaSpec `json:"json_schema,omitempty"`
+	Schema     json.RawMessage `json:"schema,omitempty"` // llama.cpp json_object extension
+}
+
+type JSONSchemaSpec struct {
+	Name   string          `json:"name"`
+	Schema json.RawMessage `json:"schema"`
+	Strict bool            `json:"strict,omitempty"`
+}
+
+// applyFormat sets the request fields that constrain output for the call.
+func (c *Client) applyFormat(req *ChatRequest, opts CallOptions) {
+	if opts.Grammar != "" {
+		req.Grammar = opts.Grammar
+	}
+	if opts.Schema == nil {
+		return
+	}
+
+	switch c.structured {
+	case StructuredJSONSchema:
+		req.ResponseFormat = &ResponseFormat{
+			Type:       "json_schema",
+			JSONSchema: &JSONSchemaSpec{Name: opts.Schema.Name, Schema: opts.Schema.Definition, Strict: true},
+		}
+	case StructuredJSONObject:
+		req.ResponseFormat = &ResponseFormat{Type: "json_object", Schema: opts.Schema.Definition}
+	case StructuredLlamaCpp:
+		req.JSONSchema = opts.Schema.Definition
+	}
+}
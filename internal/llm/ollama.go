@@ -0,0 +1,170 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// OllamaClient talks to Ollama's native API (/api/chat and /api/embed),
+// which honours num_predict and structured output formats that its
+// OpenAI-compatible endpoint ignores.
+type OllamaClient struct {
+	*requester
+	model     string
+	streaming bool
+}
+
+type ollamaChatRequest struct {
+	Model    string          `json:"model"`
+	Messages []Message       `json:"messages"`
+	Stream   bool            `json:"stream"`
+	Format   json.RawMessage `json:"format,omitempty"` // "json" or a JSON schema
+	Options  ollamaOptions   `json:"options"`
+}
+
+type ollamaOptions struct {
+	NumPredict      int      `json:"num_predict,omitempty"`
+	Temperature     *float64 `json:"temperature,omitempty"`
+	TopP            float64  `json:"top_p,omitempty"`
+	RepeatPenalty   float64  `json:"repeat_penalty,omitempty"`
+	PresencePenalty float64  `json:"presence_penalty,omitempty"`
+	Seed            *int     `json:"seed,omitempty"`
+	Stop            []string `json:"stop,omitempty"`
+}
+
+type ollamaChatResponse struct {
+	Model           string  `json:"model"`
+	Message         Message `json:"message"`
+	Done            bool    `json:"done"`
+	DoneReason      string  `json:"done_reason"`
+	PromptEvalCount int     `json:"prompt_eval_count"`
+	EvalCount       int     `json:"eval_count"`
+}
+
+type ollamaEmbedRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type ollamaEmbedResponse struct {
+	Embeddings [][]float64 `json:"embeddings"`
+}
+
+func NewOllamaClient(endpoint, model string, opts Options) *OllamaClient {
+	// Ollama has no auth of its own, but is often run behind a proxy that does
+	return &OllamaClient{
+		requester: newRequester(endpoint, opts, bearerAuth),
+		model:     model,
+		streaming: opts.Stream,
+	}
+}
+
+func (c *OllamaClient) Model() string {
+	return c.model
+}
+
+func (c *OllamaClient) Chat(ctx context.Context, messages []Message, opts CallOptions) (*ChatResponse, error) {
+	sampling := opts.sampling()
+	req := ollamaChatRequest{
+		Model:    c.model,
+		Messages: messages,
+		Options: ollamaOptions{
+			NumPredict:      opts.MaxTokens,
+			Temperature:     sampling.Temperature,
+			TopP:            sampling.TopP,
+			RepeatPenalty:   sampling.RepeatPenalty,
+			PresencePenalty: sampling.PresencePenalty,
+			Seed:            sampling.Seed,
+			Stop:            sampling.Stop,
+		},
+	}
+
+	// Ollama takes a schema or "json" in one field; grammars are unsupported
+	if opts.Schema != nil {
+		switch c.structured {
+		case StructuredJSONSchema, StructuredLlamaCpp:
+			req.Format = opts.Schema.Definition
+		case StructuredJSONObject:
+			req.Format = json.RawMessage(`"json"`)
+		}
+	}
+
+	if c.streaming {
+		req.Stream = true
+		return c.chatStream(ctx, req, opts)
+	}
+
+	var resp ollamaChatResponse
+	if err := c.post(ctx, "/api/chat", req, &resp); err != nil {
+		return nil, err
+	}
+
+	return &ChatResponse{
+		Choices: []Choice{{Message: resp.Message, FinishReason: resp.DoneReason}},
+		Usage:   resp.usage(),
+	}, nil
+}
+
+// chatStream reads Ollama's newline-delimited JSON stream.
+func (c *OllamaClient) chatStream(ctx context.Context, req ollamaChatRequest, opts CallOptions) (*ChatResponse, error) {
+	var resp *ChatResponse
+	err := c.stream(ctx, "/api/chat", req, func(body io.Reader) error {
+		acc := newStreamAccumulator(opts.OnProgress)
+		var usage Usage
+
+		err := readLines(body, func(line []byte) error {
+			var chunk ollamaChatResponse
+			if err := json.Unmarshal(line, &chunk); err != nil {
+				return fmt.Errorf("decode stream chunk: %w", err)
+			}
+			if err := acc.add(chunk.Message.Content); err != nil {
+				return err
+			}
+			if chunk.Done {
+				acc.finish = chunk.DoneReason
+				usage = chunk.usage()
+				return errStopStream
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		resp = acc.response(usage)
+		return nil
+	})
+	return resp, err
+}
+
+func (r ollamaChatResponse) usage() Usage {
+	return Usage{
+		PromptTokens:     r.PromptEvalCount,
+		CompletionTokens: r.EvalCount,
+		TotalTokens:      r.PromptEvalCount + r.EvalCount,
+	}
+}
+
+// Embed returns one embedding vector per input, in input order. An empty
+// model uses the client's chat model.
+func (c *OllamaClient) Embed(ctx context.Context, model string, inputs []string) ([][]float64, error) {
+	if model == "" {
+		model = c.model
+	}
+
+	var resp ollamaEmbedResponse
+	if err := c.post(ctx, "/api/embed", ollamaEmbedRequest{Model: model, Input: inputs}, &resp); err != nil {
+		return nil, err
+	}
+
+	if len(resp.Embeddings) != len(inputs) {
+		return nil, fmt.Errorf("got %d embeddings for %d inputs", len(resp.Embeddings), len(inputs))
+	}
+	return resp.Embeddings, nil
+}
+
+func (c *OllamaClient) HealthCheck(ctx context.Context) error {
+	return c.get(ctx, "/api/version")
+}
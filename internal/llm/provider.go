@@ -0,0 +1,41 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+)
+
+// Provider is a chat backend. Implementations translate to and from their
+// native API so callers always see the OpenAI-style ChatResponse, with
+// FinishReason "length" when output was cut off by MaxTokens.
+type Provider interface {
+	Chat(ctx context.Context, messages []Message, opts CallOptions) (*ChatResponse, error)
+	Model() string
+}
+
+// Embedder is implemented by providers that can compute embeddings.
+type Embedder interface {
+	Embed(ctx context.Context, model string, inputs []string) ([][]float64, error)
+}
+
+// Provider kinds accepted by NewProvider.
+const (
+	ProviderOpenAI    = "openai" // OpenAI-compatible /v1/chat/completions
+	ProviderOllama    = "ollama" // Ollama's native /api/chat
+	ProviderAnthropic = "anthropic"
+)
+
+// NewProvider creates a provider of the given kind; an empty kind means
+// ProviderOpenAI.
+func NewProvider(kind, endpoint, model string, opts Options) (Provider, error) {
+	switch kind {
+	case "", ProviderOpenAI:
+		return NewClient(endpoint, model, opts), nil
+	case ProviderOllama:
+		return NewOllamaClient(endpoint, model, opts), nil
+	case ProviderAnthropic:
+		return NewAnthropicClient(endpoint, model, opts), nil
+	default:
+		return nil, fmt.Errorf("invalid LLM provider %q (expected openai, ollama or anthropic)", kind)
+	}
+}
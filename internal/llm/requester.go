@@ -0,0 +1,144 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/defilan/issueparser/internal/httpretry"
+)
+
+// requester sends JSON requests to an LLM endpoint with retries, per-attempt
+// timeouts and a circuit breaker. Every provider shares it so they fail and
+// recover the same way.
+type requester struct {
+	httpClient     *http.Client
+	endpoint       string
+	header         http.Header // sent with every request
+	retryPolicy    RetryPolicy
+	requestTimeout time.Duration
+	breaker        *circuitBreaker
+	structured     StructuredMode
+}
+
+const llmClientTimeout = 5 * time.Minute // LLM calls can be slow
+
+// newRequester builds the shared requester. setAuth adds the provider's
+// auth header and is only called when an API key is configured; explicit
+// headers from opts are applied afterwards so they can override it.
+func newRequester(endpoint string, opts Options, setAuth func(h http.Header, apiKey string)) *requester {
+	retry := opts.Retry
+	if retry.MaxAttempts == 0 {
+		retry = DefaultRetryPolicy()
+	}
+	cooldown := opts.BreakerCooldown
+	if cooldown <= 0 {
+		cooldown = time.Minute
+	}
+	structured := opts.StructuredOutput
+	if structured == "" {
+		structured = StructuredJSONSchema
+	}
+
+	header := make(http.Header)
+	if opts.APIKey != "" {
+		setAuth(header, opts.APIKey)
+	}
+	for name, values := range opts.Headers {
+		header.Del(name)
+		for _, v := range values {
+			header.Add(name, v)
+		}
+	}
+
+	return &requester{
+		httpClient:     newHTTPClient(opts.TLS, opts.RequestTimeout),
+		endpoint:       endpoint,
+		header:         header,
+		retryPolicy:    retry,
+		requestTimeout: opts.RequestTimeout,
+		breaker:        &circuitBreaker{threshold: opts.BreakerThreshold, cooldown: cooldown, transient: retry.transient},
+		structured:     structured,
+	}
+}
+
+// bearerAuth sends the API key as a bearer token, as OpenAI-compatible
+// servers and most proxies expect.
+func bearerAuth(h http.Header, apiKey string) {
+	h.Set("Authorization", "Bearer "+apiKey)
+}
+
+// post sends a JSON request to the endpoint, retrying per the policy, and
+// decodes the JSON response into out.
+func (r *requester) post(ctx context.Context, path string, payload, out any) error {
+	return r.stream(ctx, path, payload, func(body io.Reader) error {
+		if err := json.NewDecoder(body).Decode(out); err != nil {
+			return fmt.Errorf("decode response: %w", err)
+		}
+		return nil
+	})
+}
+
+// stream sends a JSON request like post but hands the response body to
+// read. A failed attempt is retried from the start, so read must not keep
+// state across calls.
+func (r *requester) stream(ctx context.Context, path string, payload any, read func(body io.Reader) error) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal request: %w", err)
+	}
+
+	return r.retry(ctx, func(ctx context.Context) error {
+		url := r.endpoint + path
+		httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("create request: %w", err)
+		}
+
+		httpReq.Header = r.header.Clone()
+		httpReq.Header.Set("Content-Type", "application/json")
+
+		resp, err := r.httpClient.Do(httpReq)
+		if err != nil {
+			return fmt.Errorf("request failed: %w", err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+
+		if resp.StatusCode != 200 {
+			respBody, _ := io.ReadAll(resp.Body)
+			retryAfter, _ := httpretry.ParseRetryAfter(resp.Header.Get("Retry-After"))
+			return &APIError{
+				StatusCode: resp.StatusCode,
+				Body:       string(respBody),
+				RetryAfter: retryAfter,
+			}
+		}
+
+		return read(resp.Body)
+	})
+}
+
+// get checks that path answers with 200, without retrying.
+func (r *requester) get(ctx context.Context, path string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", r.endpoint+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header = r.header.Clone()
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("health check failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("unhealthy status: %d", resp.StatusCode)
+	}
+
+	return nil
+}
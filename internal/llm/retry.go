@@ -0,0 +1,241 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without contacting the endpoint after too many
+// consecutive requests have failed.
+var ErrCircuitOpen = errors.New("LLM endpoint unavailable: circuit breaker open")
+
+// RetryPolicy controls how failed LLM requests are retried.
+type RetryPolicy struct {
+	MaxAttempts    int           // total attempts per request, including the first
+	InitialBackoff time.Duration // doubled after every failed attempt
+	MaxBackoff     time.Duration
+	RetryStatuses  []int // HTTP statuses worth retrying
+
+	// RetryError reports whether an error other than an HTTP status is worth
+	// retrying; nil uses TransientError.
+	RetryError func(err error) bool
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 2 * time.Second,
+		MaxBackoff:     30 * time.Second,
+		RetryStatuses: []int{
+			http.StatusRequestTimeout,
+			http.StatusTooManyRequests,
+			http.StatusInternalServerError,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+		RetryError: TransientError,
+	}
+}
+
+// TransientError reports whether err is a network failure, an attempt
+// timeout or a connection cut off mid-response. Other errors, such as a
+// response that does not decode, would fail the same way again.
+func TransientError(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func (p RetryPolicy) transient(err error) bool {
+	if p.RetryError != nil {
+		return p.RetryError(err)
+	}
+	return TransientError(err)
+}
+
+// APIError is a non-200 response from the LLM endpoint.
+type APIError struct {
+	StatusCode int
+	Body       string
+	RetryAfter time.Duration // from the Retry-After header, if any
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("LLM API error %d: %s", e.StatusCode, e.Body)
+}
+
+func (p RetryPolicy) retryable(ctx context.Context, err error) bool {
+	// The caller gave up; retrying can't help
+	if ctx.Err() != nil {
+		return false
+	}
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return p.transient(err)
+	}
+	for _, status := range p.RetryStatuses {
+		if apiErr.StatusCode == status {
+			return true
+		}
+	}
+	return false
+}
+
+func (p RetryPolicy) backoff(attempt int, err error) time.Duration {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		return apiErr.RetryAfter
+	}
+
+	d := p.InitialBackoff << attempt
+	if d <= 0 || (p.MaxBackoff > 0 && d > p.MaxBackoff) {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	// Jitter between half and full delay so parallel callers spread out
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retry runs fn until it succeeds, returns a non-retryable error or runs out
+// of attempts. Each attempt gets its own timeout when one is configured.
+func (r *requester) retry(ctx context.Context, fn func(ctx context.Context) error) error {
+	probe, err := r.breaker.allow()
+	if err != nil {
+		return err
+	}
+
+	attempts := r.retryPolicy.MaxAttempts
+	if attempts <= 0 {
+		attempts = 1
+	}
+
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			wait := r.retryPolicy.backoff(attempt-1, err)
+			fmt.Printf("    LLM request failed (%v), retrying in %s (attempt %d/%d)...\n",
+				err, wait.Round(time.Second), attempt+1, attempts)
+			if sleepErr := sleep(ctx, wait); sleepErr != nil {
+				break
+			}
+		}
+
+		err = r.attempt(ctx, fn)
+		if err == nil || !r.retryPolicy.retryable(ctx, err) {
+			break
+		}
+	}
+
+	r.breaker.record(err, probe)
+	return err
+}
+
+func (r *requester) attempt(ctx context.Context, fn func(ctx context.Context) error) error {
+	if r.requestTimeout <= 0 {
+		return fn(ctx)
+	}
+	attemptCtx, cancel := context.WithTimeout(ctx, r.requestTimeout)
+	defer cancel()
+	return fn(attemptCtx)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// circuitBreaker stops a run from hammering an endpoint that is clearly
+// down. After threshold consecutive failed requests it rejects calls for the
+// cooldown period, then lets one trial request through. Other calls are
+// rejected until the trial finishes; its failure reopens the breaker for
+// another cooldown, its success closes it.
+type circuitBreaker struct {
+	threshold int // 0 disables the breaker
+	cooldown  time.Duration
+	transient func(err error) bool // non-API errors that count as failures
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool // a trial request is in flight
+}
+
+// allow reports whether a request may be sent, and whether it is the trial
+// request of a breaker that was open. The result must be passed to record.
+func (b *circuitBreaker) allow() (probe bool, err error) {
+	if b == nil || b.threshold <= 0 {
+		return false, nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return false, nil
+	}
+	if b.probing || time.Now().Before(b.openUntil) {
+		return false, ErrCircuitOpen
+	}
+	b.probing = true
+	return true, nil
+}
+
+func (b *circuitBreaker) record(err error, probe bool) {
+	if b == nil || b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if probe {
+		b.probing = false
+	}
+	if err == nil {
+		b.failures = 0
+		return
+	}
+
+	// Client-side errors (bad request, context too long) and responses that
+	// fail to decode say nothing about endpoint health
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		if apiErr.StatusCode >= 400 && apiErr.StatusCode < 500 &&
+			apiErr.StatusCode != http.StatusRequestTimeout && apiErr.StatusCode != http.StatusTooManyRequests {
+			return
+		}
+	} else if b.transient != nil && !b.transient(err) {
+		return
+	}
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
@@ -0,0 +1,110 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryable(t *testing.T) {
+	var syntaxErr error = &json.SyntaxError{Offset: 3}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"connection refused", fmt.Errorf("request failed: %w", &net.OpError{Op: "dial", Err: errors.New("connection refused")}), true},
+		{"attempt timeout", fmt.Errorf("request failed: %w", context.DeadlineExceeded), true},
+		{"cut off response", fmt.Errorf("decode response: %w", io.ErrUnexpectedEOF), true},
+		{"malformed response", fmt.Errorf("decode response: %w", syntaxErr), false},
+		{"malformed stream chunk", fmt.Errorf("decode stream chunk: %w", syntaxErr), false},
+		{"retryable status", &APIError{StatusCode: http.StatusServiceUnavailable}, true},
+		{"client error", &APIError{StatusCode: http.StatusBadRequest}, false},
+	}
+
+	policy := DefaultRetryPolicy()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.retryable(context.Background(), tt.err); got != tt.want {
+				t.Errorf("retryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("custom error classes", func(t *testing.T) {
+		policy := RetryPolicy{RetryError: func(err error) bool { return errors.Is(err, io.ErrUnexpectedEOF) }}
+		if policy.retryable(context.Background(), context.DeadlineExceeded) {
+			t.Error("retried an error the policy does not list")
+		}
+		if !policy.retryable(context.Background(), io.ErrUnexpectedEOF) {
+			t.Error("did not retry an error the policy lists")
+		}
+	})
+
+	t.Run("canceled caller", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if policy.retryable(ctx, context.DeadlineExceeded) {
+			t.Error("retried after the caller gave up")
+		}
+	})
+}
+
+func TestCircuitBreakerIgnoresMalformedResponses(t *testing.T) {
+	b := &circuitBreaker{threshold: 1, cooldown: time.Hour, transient: TransientError}
+	b.record(fmt.Errorf("decode response: %w", &json.SyntaxError{}), false)
+	if _, err := b.allow(); err != nil {
+		t.Fatalf("allow() after a malformed response = %v, want nil", err)
+	}
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	b := &circuitBreaker{threshold: 2, cooldown: time.Hour}
+	down := errors.New("connection refused")
+
+	for i := 0; i < 2; i++ {
+		probe, err := b.allow()
+		if err != nil || probe {
+			t.Fatalf("closed breaker: allow() = %v, %v", probe, err)
+		}
+		b.record(down, probe)
+	}
+	if _, err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("open breaker: allow() error = %v, want ErrCircuitOpen", err)
+	}
+
+	// After the cooldown only one caller gets through
+	b.openUntil = time.Now().Add(-time.Second)
+	probe, err := b.allow()
+	if err != nil || !probe {
+		t.Fatalf("after cooldown: allow() = %v, %v, want the trial request", probe, err)
+	}
+	if _, err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("during trial: allow() error = %v, want ErrCircuitOpen", err)
+	}
+
+	// A failed trial reopens the breaker for another cooldown
+	b.record(down, probe)
+	if _, err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("after failed trial: allow() error = %v, want ErrCircuitOpen", err)
+	}
+
+	// A successful trial closes it
+	b.openUntil = time.Now().Add(-time.Second)
+	probe, err = b.allow()
+	if err != nil || !probe {
+		t.Fatalf("after second cooldown: allow() = %v, %v, want the trial request", probe, err)
+	}
+	b.record(nil, probe)
+	for i := 0; i < 3; i++ {
+		if probe, err := b.allow(); err != nil || probe {
+			t.Fatalf("after successful trial: allow() = %v, %v", probe, err)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package llm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Sampling controls how a response is generated. Unset fields are left to
+// the server's defaults; Temperature and Seed are pointers because zero is
+// a meaningful value for both.
+type Sampling struct {
+	Temperature     *float64 `json:"temperature,omitempty"`
+	TopP            float64  `json:"top_p,omitempty"`
+	RepeatPenalty   float64  `json:"repeat_penalty,omitempty"` // llama.cpp and Ollama only
+	PresencePenalty float64  `json:"presence_penalty,omitempty"`
+	Seed            *int     `json:"seed,omitempty"` // not supported by Anthropic
+	Stop            []string `json:"stop,omitempty"`
+}
+
+// DefaultSampling is used for calls without a sampling profile. It leans
+// towards varied output because small local models tend to repeat
+// themselves, and stops when a model starts padding its output.
+func DefaultSampling() Sampling {
+	return Sampling{
+		Temperature:     Float(0.7),
+		TopP:            0.9,
+		RepeatPenalty:   1.15,
+		PresencePenalty: 0.1,
+		Stop:            []string{"```\n\n", "\n\n\n\n"},
+	}
+}
+
+// Float returns a pointer to f, for setting Sampling.Temperature.
+func Float(f float64) *float64 {
+	return &f
+}
+
+// Int returns a pointer to n, for setting Sampling.Seed.
+func Int(n int) *int {
+	return &n
+}
+
+// String renders the profile for logs and reports, e.g.
+// "temperature=0.2 top_p=0.9 seed=42".
+func (s Sampling) String() string {
+	var parts []string
+	if s.Temperature != nil {
+		parts = append(parts, "temperature="+formatFloat(*s.Temperature))
+	}
+	if s.TopP != 0 {
+		parts = append(parts, "top_p="+formatFloat(s.TopP))
+	}
+	if s.RepeatPenalty != 0 {
+		parts = append(parts, "repeat_penalty="+formatFloat(s.RepeatPenalty))
+	}
+	if s.PresencePenalty != 0 {
+		parts = append(parts, "presence_penalty="+formatFloat(s.PresencePenalty))
+	}
+	if s.Seed != nil {
+		parts = append(parts, fmt.Sprintf("seed=%d", *s.Seed))
+	}
+	if len(parts) == 0 {
+		return "server defaults"
+	}
+	return strings.Join(parts, " ")
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// sampling returns the call's profile, or DefaultSampling if it has none.
+func (o CallOptions) sampling() Sampling {
+	if o.Sampling != nil {
+		return *o.Sampling
+	}
+	return DefaultSampling()
+}
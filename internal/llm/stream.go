@@ -0,0 +1,153 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	repetitionCheckEvery = 64  // bytes of new output between repetition checks
+	repetitionMaxPeriod  = 200 // longest repeated unit detected, in bytes
+	repetitionMinSpan    = 240 // bytes the repeated run must cover
+	repetitionMinRepeats = 4
+)
+
+// FinishRepetition is the finish reason of a streamed response that was
+// stopped early because the model kept repeating itself. The content is
+// cut back to where the repetition started.
+const FinishRepetition = "repetition"
+
+// StreamProgress reports a streamed response as it is generated.
+type StreamProgress struct {
+	Tokens  int // chunks received, roughly one token each
+	Elapsed time.Duration
+	Done    bool
+}
+
+func (p StreamProgress) TokensPerSecond() float64 {
+	if p.Elapsed <= 0 {
+		return 0
+	}
+	return float64(p.Tokens) / p.Elapsed.Seconds()
+}
+
+// errStopStream ends reading a stream early without failing the request.
+var errStopStream = errors.New("stop stream")
+
+// streamAccumulator assembles streamed deltas into the final message,
+// reporting progress and watching for degenerate repetition.
+type streamAccumulator struct {
+	content    strings.Builder
+	tokens     int
+	start      time.Time
+	checkedLen int
+	finish     string
+	onProgress func(StreamProgress)
+}
+
+func newStreamAccumulator(onProgress func(StreamProgress)) *streamAccumulator {
+	return &streamAccumulator{start: time.Now(), onProgress: onProgress}
+}
+
+// add appends a delta. It returns errStopStream once the output has
+// degenerated into repetition.
+func (a *streamAccumulator) add(delta string) error {
+	if delta == "" {
+		return nil
+	}
+	a.content.WriteString(delta)
+	a.tokens++
+	a.report(false)
+
+	if a.content.Len()-a.checkedLen < repetitionCheckEvery {
+		return nil
+	}
+	a.checkedLen = a.content.Len()
+
+	if cut, ok := repetitionStart(a.content.String()); ok {
+		fmt.Printf("    Output degenerated into repetition after %d tokens, stopping generation early\n", a.tokens)
+		kept := a.content.String()[:cut]
+		a.content.Reset()
+		a.content.WriteString(kept)
+		a.finish = FinishRepetition
+		return errStopStream
+	}
+	return nil
+}
+
+func (a *streamAccumulator) report(done bool) {
+	if a.onProgress != nil {
+		a.onProgress(StreamProgress{Tokens: a.tokens, Elapsed: time.Since(a.start), Done: done})
+	}
+}
+
+func (a *streamAccumulator) response(usage Usage) *ChatResponse {
+	a.report(true)
+	return &ChatResponse{
+		Choices: []Choice{{
+			Message:      Message{Role: "assistant", Content: a.content.String()},
+			FinishReason: a.finish,
+		}},
+		Usage: usage,
+	}
+}
+
+// repetitionStart checks whether s ends in the same unit repeated over and
+// over, and if so returns the offset after the first copy of the unit.
+func repetitionStart(s string) (int, bool) {
+	for period := 1; period <= repetitionMaxPeriod && period*repetitionMinRepeats <= len(s); period++ {
+		// Length of the suffix that repeats with this period
+		run := period
+		for run < len(s) && s[len(s)-1-run] == s[len(s)-1-run+period] {
+			run++
+		}
+		if run >= repetitionMinSpan && run >= period*repetitionMinRepeats {
+			return len(s) - run + period, true
+		}
+	}
+	return 0, false
+}
+
+// readSSE calls fn with the data of each server-sent event until the
+// stream ends, fn returns an error or a "[DONE]" event arrives.
+func readSSE(body io.Reader, fn func(data []byte) error) error {
+	return readLines(body, func(line []byte) error {
+		data, ok := bytes.CutPrefix(line, []byte("data:"))
+		if !ok {
+			return nil // comments, event names and blank separators
+		}
+		data = bytes.TrimSpace(data)
+		if string(data) == "[DONE]" {
+			return errStopStream
+		}
+		return fn(data)
+	})
+}
+
+// readLines calls fn for each non-empty line of body. errStopStream from fn
+// ends reading without an error.
+func readLines(body io.Reader, fn func(line []byte) error) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if err := fn(line); err != nil {
+			if errors.Is(err, errStopStream) {
+				return nil
+			}
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read stream: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package llm
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// EstimateTokens approximates how many tokens a BPE tokenizer (Qwen, Llama,
+// GPT) produces for s without loading a vocabulary. Runs of ASCII letters and
+// digits cost about one token per four characters, punctuation and symbols
+// about one each, and non-ASCII letters (CJK, accented text) roughly one per
+// rune. It tends to overestimate slightly, which is the safe direction when
+// packing prompts.
+func EstimateTokens(s string) int {
+	tokens := 0
+	run := 0 // length of the current ASCII letter/digit run
+
+	flush := func() {
+		tokens += (run + 3) / 4
+		run = 0
+	}
+
+	for _, r := range s {
+		switch {
+		case r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			run++
+		case unicode.IsSpace(r):
+			// Whitespace is usually merged into the following token
+			flush()
+		default:
+			flush()
+			tokens++
+		}
+	}
+	flush()
+
+	return tokens
+}
@@ -0,0 +1,30 @@
+package llm
+
+import "testing"
+
+func TestEstimateTokens(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want int
+	}{
+		{"empty", "", 0},
+		{"whitespace", " \n\t ", 0},
+		{"short word", "gpu", 1},
+		{"four letters per token", "performance", 3},
+		{"words", "out of memory", 4},
+		{"digits", "12345678", 2},
+		{"punctuation", "a, b!", 4},
+		{"symbols", "{\"a\":1}", 7},
+		{"CJK", "内存不足", 4},
+		{"accented", "café", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EstimateTokens(tt.in); got != tt.want {
+				t.Errorf("EstimateTokens(%q) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
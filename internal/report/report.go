@@ -1,17 +1,22 @@
 package report
 
 import (
+	"encoding/csv"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/defilan/issueparser/internal/analyzer"
+	"github.com/defilan/issueparser/internal/llm"
 )
 
 type Report struct {
 	analysis *analyzer.Analysis
 	opts     Options
+	depth    int // extra heading levels when rendered as a section
 }
 
 type Options struct {
@@ -19,6 +24,18 @@ type Options struct {
 	Repos      []string
 	Keywords   []string
 	IssueCount int
+
+	// Run metadata for the methodology section
+	Model    string
+	Provider string
+	Sampling []StageSampling
+	Pricing  analyzer.Pricing // estimates cost in the usage table when set
+}
+
+// StageSampling records the sampling profile used for an analysis stage.
+type StageSampling struct {
+	Stage    string       `json:"stage"`
+	Sampling llm.Sampling `json:"sampling"`
 }
 
 func New(analysis *analyzer.Analysis, opts Options) *Report {
@@ -31,16 +48,99 @@ func New(analysis *analyzer.Analysis, opts Options) *Report {
 func (r *Report) WriteMarkdown(filename string) error {
 	var sb strings.Builder
 
-	// Header
+	r.writeHeader(&sb)
+	r.writeBody(&sb)
+	r.writeMethodology(&sb)
+	r.writeVerification(&sb)
+	r.writeUsage(&sb)
+
+	return os.WriteFile(filename, []byte(sb.String()), 0644)
+}
+
+// Section is one named analysis in a report that covers several analysis
+// profiles of the same issues.
+type Section struct {
+	Name       string
+	FocusAreas []string
+	IssueCount int
+	Analysis   *analyzer.Analysis
+}
+
+// WriteSectionsMarkdown writes several analyses of the same issues as one
+// report with a section per analysis. opts describes the shared run; its
+// IssueCount is the number of issues fetched.
+func WriteSectionsMarkdown(filename string, opts Options, sections []Section) error {
+	var sb strings.Builder
+
+	shared := New(&analyzer.Analysis{}, opts)
+	shared.writeHeader(&sb)
+	sb.WriteString("## Contents\n\n")
+	for _, section := range sections {
+		sb.WriteString(fmt.Sprintf("- [%s](#%s) - %d themes from %d issues\n",
+			section.Name, anchor(section.Name), len(section.Analysis.Themes), section.IssueCount))
+	}
+	sb.WriteString("\n---\n\n")
+
+	for _, section := range sections {
+		sectionOpts := opts
+		sectionOpts.Keywords = section.FocusAreas
+		sectionOpts.IssueCount = section.IssueCount
+		r := &Report{analysis: section.Analysis, opts: sectionOpts, depth: 1}
+
+		sb.WriteString(fmt.Sprintf("## %s\n\n", section.Name))
+		sb.WriteString(fmt.Sprintf("**Focus:** %s\n", strings.Join(section.FocusAreas, ", ")))
+		sb.WriteString(fmt.Sprintf("**Issues Analyzed:** %d\n\n", section.IssueCount))
+		r.writeBody(&sb)
+	}
+
+	shared.writeMethodology(&sb)
+	for _, section := range sections {
+		r := &Report{analysis: section.Analysis, opts: opts}
+		if r.analysis.Verification == (analyzer.Verification{}) && len(r.analysis.Usage) == 0 {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("\n### %s\n", section.Name))
+		r.writeVerification(&sb)
+		r.writeUsage(&sb)
+	}
+
+	return os.WriteFile(filename, []byte(sb.String()), 0644)
+}
+
+// anchor returns the GitHub markdown anchor of a heading.
+func anchor(heading string) string {
+	var sb strings.Builder
+	for _, c := range strings.ToLower(heading) {
+		switch {
+		case c == ' ':
+			sb.WriteRune('-')
+		case c == '-' || c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c):
+			sb.WriteRune(c)
+		}
+	}
+	return sb.String()
+}
+
+// heading returns the markdown heading marker for a level, deepened when
+// the report is rendered as a section.
+func (r *Report) heading(level int) string {
+	return strings.Repeat("#", level+r.depth)
+}
+
+func (r *Report) writeHeader(sb *strings.Builder) {
 	sb.WriteString(fmt.Sprintf("# %s\n\n", r.opts.Title))
 	sb.WriteString(fmt.Sprintf("**Generated:** %s\n", time.Now().Format("January 2, 2006")))
 	sb.WriteString(fmt.Sprintf("**Repositories:** %s\n", strings.Join(r.opts.Repos, ", ")))
 	sb.WriteString(fmt.Sprintf("**Keywords:** %s\n", strings.Join(r.opts.Keywords, ", ")))
 	sb.WriteString(fmt.Sprintf("**Issues Analyzed:** %d\n\n", r.opts.IssueCount))
 	sb.WriteString("---\n\n")
+}
 
+// writeBody renders the findings: summary, themes, quotes, action items
+// and classifications.
+func (r *Report) writeBody(sb *strings.Builder) {
 	// Executive Summary
-	sb.WriteString("## Executive Summary\n\n")
+	sb.WriteString(r.heading(2) + " Executive Summary\n\n")
 	if len(r.analysis.KeyInsights) > 0 {
 		for _, insight := range r.analysis.KeyInsights {
 			sb.WriteString(fmt.Sprintf("- %s\n", insight))
@@ -53,12 +153,12 @@ func (r *Report) WriteMarkdown(filename string) error {
 
 	// Themes
 	sb.WriteString("---\n\n")
-	sb.WriteString("## Identified Themes\n\n")
+	sb.WriteString(r.heading(2) + " Identified Themes\n\n")
 
 	for i, theme := range r.analysis.Themes {
 		// Theme header with severity badge
 		severityBadge := r.severityBadge(theme.Severity)
-		sb.WriteString(fmt.Sprintf("### %d. %s %s\n\n", i+1, theme.Name, severityBadge))
+		sb.WriteString(fmt.Sprintf("%s %d. %s %s\n\n", r.heading(3), i+1, theme.Name, severityBadge))
 
 		// Issue count
 		if theme.IssueCount > 0 {
@@ -78,8 +178,14 @@ func (r *Report) WriteMarkdown(filename string) error {
 			}
 		}
 
-		// Issue links
-		if len(theme.IssueURLs) > 0 {
+		// Issue links, labelled with the repo so multi-repo runs stay unambiguous
+		if len(theme.Issues) > 0 {
+			sb.WriteString("**Related Issues:**\n")
+			for _, ref := range theme.Issues {
+				sb.WriteString(fmt.Sprintf("- [%s](%s)\n", ref, ref.URL()))
+			}
+			sb.WriteString("\n")
+		} else if len(theme.IssueURLs) > 0 {
 			sb.WriteString("**Related Issues:**\n")
 			for _, url := range theme.IssueURLs {
 				sb.WriteString(fmt.Sprintf("- %s\n", url))
@@ -92,7 +198,7 @@ func (r *Report) WriteMarkdown(filename string) error {
 
 	// Notable Quotes Section
 	if len(r.analysis.Quotes) > 0 {
-		sb.WriteString("## Notable Quotes\n\n")
+		sb.WriteString(r.heading(2) + " Notable Quotes\n\n")
 		for _, quote := range r.analysis.Quotes {
 			sb.WriteString(fmt.Sprintf("> \"%s\"\n", quote.Text))
 			if quote.Source != "" {
@@ -102,6 +208,9 @@ func (r *Report) WriteMarkdown(filename string) error {
 				}
 				sb.WriteString("\n")
 			}
+			if !quote.Verified {
+				sb.WriteString("> *(unverified: not found in the source issue)*\n")
+			}
 			sb.WriteString("\n")
 		}
 		sb.WriteString("---\n\n")
@@ -109,23 +218,103 @@ func (r *Report) WriteMarkdown(filename string) error {
 
 	// Action Items
 	if len(r.analysis.ActionItems) > 0 {
-		sb.WriteString("## Potential Action Items\n\n")
+		sb.WriteString(r.heading(2) + " Potential Action Items\n\n")
 		for _, item := range r.analysis.ActionItems {
 			sb.WriteString(fmt.Sprintf("- [ ] %s\n", item))
 		}
 		sb.WriteString("\n---\n\n")
 	}
 
+	// Per-issue classification
+	if len(r.analysis.Classifications) > 0 {
+		r.writeClassifications(sb)
+	}
+}
+
+// writeMethodology describes how the analysis was produced.
+func (r *Report) writeMethodology(sb *strings.Builder) {
 	// LLMKube Attribution
 	sb.WriteString("## Methodology\n\n")
 	sb.WriteString("This analysis was performed using:\n")
 	sb.WriteString("- **IssueParser** - GitHub issue theme analyzer\n")
 	sb.WriteString("- **LLMKube** - Kubernetes-native LLM inference platform\n")
-	sb.WriteString("- **Model:** Qwen 2.5 14B (dual GPU inference)\n\n")
+	if r.opts.Model != "" {
+		sb.WriteString(fmt.Sprintf("- **Model:** %s", r.opts.Model))
+		if r.opts.Provider != "" {
+			sb.WriteString(fmt.Sprintf(" (%s API)", r.opts.Provider))
+		}
+		sb.WriteString("\n")
+	} else {
+		sb.WriteString("- **Model:** Qwen 2.5 14B (dual GPU inference)\n")
+	}
+	for _, stage := range r.opts.Sampling {
+		sb.WriteString(fmt.Sprintf("- **%s sampling:** %s\n", stage.Stage, stage.Sampling))
+	}
+	sb.WriteString("\n")
 	sb.WriteString("Issues were fetched via GitHub REST API, batched, and analyzed ")
 	sb.WriteString("for common themes using LLM-powered pattern recognition.\n")
+}
 
-	return os.WriteFile(filename, []byte(sb.String()), 0644)
+// writeVerification summarizes how the model's citations held up against
+// the fetched issues.
+func (r *Report) writeVerification(sb *strings.Builder) {
+	v := r.analysis.Verification
+	if v.CitedIssues == 0 && v.Quotes == 0 {
+		return
+	}
+
+	sb.WriteString("\n**Citation checks:**\n")
+	if v.CitedIssues > 0 {
+		sb.WriteString(fmt.Sprintf("- %d of %d issue references cited by the model were not among the analyzed issues and were discarded\n",
+			v.RejectedIssues, v.CitedIssues))
+	}
+	if v.Quotes > 0 {
+		sb.WriteString(fmt.Sprintf("- %d of %d quotes were found in the source issues", v.VerifiedQuotes, v.Quotes))
+		if v.DroppedQuotes > 0 {
+			sb.WriteString(fmt.Sprintf("; %d unverified quotes were removed", v.DroppedQuotes))
+		}
+		sb.WriteString("\n")
+	}
+}
+
+// writeUsage tabulates LLM token usage and latency per stage.
+func (r *Report) writeUsage(sb *strings.Builder) {
+	stages := r.analysis.Usage
+	if len(stages) == 0 {
+		return
+	}
+
+	withCost := !r.opts.Pricing.IsZero()
+	sb.WriteString("\n**LLM usage:**\n\n")
+	sb.WriteString("| Stage | Calls | Prompt tokens | Completion tokens | Latency | Tokens/sec |")
+	if withCost {
+		sb.WriteString(" Est. cost |")
+	}
+	sb.WriteString("\n|-------|-------|---------------|-------------------|---------|------------|")
+	if withCost {
+		sb.WriteString("-----------|")
+	}
+	sb.WriteString("\n")
+
+	total := analyzer.TotalUsage(stages)
+	estimated := false
+	for _, u := range append(append([]analyzer.StageUsage{}, stages...), total) {
+		sb.WriteString(fmt.Sprintf("| %s | %d | %d | %d | %s | %.1f |",
+			u.Stage, u.Calls, u.PromptTokens, u.CompletionTokens, u.Latency.Round(time.Second), u.TokensPerSecond()))
+		if withCost {
+			sb.WriteString(fmt.Sprintf(" $%.4f |", u.Cost(r.opts.Pricing)))
+		}
+		sb.WriteString("\n")
+		estimated = estimated || u.Estimated
+	}
+
+	if estimated {
+		sb.WriteString("\nSome token counts are estimates; the server did not report usage for every call.\n")
+	}
+	if total.CachedCalls > 0 {
+		sb.WriteString(fmt.Sprintf("\n%d further calls were answered from the response cache and are not counted above.\n",
+			total.CachedCalls))
+	}
 }
 
 func (r *Report) severityBadge(severity string) string {
@@ -140,3 +329,66 @@ func (r *Report) severityBadge(severity string) string {
 		return ""
 	}
 }
+
+func (r *Report) writeClassifications(sb *strings.Builder) {
+	classifications := sortedClassifications(r.analysis.Classifications)
+
+	sb.WriteString(r.heading(2) + " Issue Classification\n\n")
+	sb.WriteString("| Issue | Kind | Severity | Category | Component | Summary |\n")
+	sb.WriteString("|-------|------|----------|----------|-----------|---------|\n")
+	for _, c := range classifications {
+		sb.WriteString(fmt.Sprintf("| [%s](%s) | %s | %s %s | %s | %s | %s |\n",
+			c.Issue, c.URL, c.Kind, r.severityBadge(c.Severity), c.Severity,
+			tableCell(c.Category), tableCell(c.Component), tableCell(c.Summary)))
+	}
+	sb.WriteString("\n---\n\n")
+}
+
+// WriteClassificationsCSV writes the per-issue classification table as CSV
+// for sorting and filtering in a spreadsheet.
+func (r *Report) WriteClassificationsCSV(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	w := csv.NewWriter(f)
+	if err := w.Write([]string{"repo", "number", "title", "url", "kind", "severity", "category", "component", "summary"}); err != nil {
+		return err
+	}
+	for _, c := range sortedClassifications(r.analysis.Classifications) {
+		record := []string{
+			c.Issue.Repo, fmt.Sprint(c.Issue.Number), c.Title, c.URL,
+			c.Kind, c.Severity, c.Category, c.Component, c.Summary,
+		}
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// sortedClassifications orders classifications by severity, then category.
+func sortedClassifications(classifications []analyzer.IssueClassification) []analyzer.IssueClassification {
+	rank := map[string]int{"high": 0, "medium": 1, "low": 2}
+	sorted := append([]analyzer.IssueClassification{}, classifications...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if rank[sorted[i].Severity] != rank[sorted[j].Severity] {
+			return rank[sorted[i].Severity] < rank[sorted[j].Severity]
+		}
+		return sorted[i].Category < sorted[j].Category
+	})
+	return sorted
+}
+
+// tableCell escapes text for use inside a markdown table cell.
+func tableCell(s string) string {
+	s = strings.ReplaceAll(s, "|", "\\|")
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,352 @@
+// Package store keeps a local copy of each repository's issues so runs can
+// sync incrementally and analyze offline.
+//
+// A store is a directory with one subdirectory per repository:
+//
+//	<dir>/<owner>/<repo>/issues.jsonl  one issue per line, by number
+//	<dir>/<owner>/<repo>/sync.json     what was synced and when
+package store
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/defilan/issueparser/internal/github"
+)
+
+const (
+	issuesFile = "issues.jsonl"
+	stateFile  = "sync.json"
+)
+
+// Store is a directory of per-repository issue files.
+type Store struct {
+	dir string
+}
+
+// SyncOptions selects what is mirrored from a repository. Keyword and label
+// filters are not applied here: the store holds every item of the kind so
+// any query can be answered from it.
+type SyncOptions struct {
+	Kind            github.ItemKind
+	IncludeComments bool
+	MaxComments     int
+	Full            bool // refetch everything instead of only changed items
+}
+
+// SyncResult describes one repository sync.
+type SyncResult struct {
+	Fetched     int  // items fetched from GitHub
+	Total       int  // items in the store afterwards
+	Incremental bool // only items updated since the last sync were fetched
+}
+
+// Query filters stored issues the way FetchIssues filters on GitHub.
+type Query struct {
+	Labels   []string // all must be present
+	Keywords []string // any must appear in the title, body or comments
+	State    string   // "open", "closed" or "all"
+	Kind     github.ItemKind
+	MaxItems int // newest first; 0 returns every match
+
+	IncludeComments bool // keep comment threads, up to MaxComments each
+	MaxComments     int
+}
+
+// syncState records a repository's last sync, so the next one knows where
+// to resume and whether the stored items cover what is asked for.
+type syncState struct {
+	Repo            string          `json:"repo"`
+	SyncedAt        time.Time       `json:"synced_at"`
+	LastUpdated     time.Time       `json:"last_updated"` // newest UpdatedAt seen, in GitHub's clock
+	Kind            github.ItemKind `json:"kind"`
+	IncludeComments bool            `json:"include_comments"`
+	MaxComments     int             `json:"max_comments"`
+}
+
+// covers reports whether items synced with this state satisfy opts, so
+// fetching only what changed since is enough.
+func (s *syncState) covers(opts SyncOptions) bool {
+	if s.Kind != github.KindAll && s.Kind != opts.Kind {
+		return false
+	}
+	if opts.IncludeComments && (!s.IncludeComments || s.MaxComments < opts.MaxComments) {
+		return false
+	}
+	return true
+}
+
+// Open returns the store in dir, creating the directory if needed.
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create issue store: %w", err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+func (s *Store) repoDir(repo string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(repo))
+}
+
+// Sync brings the stored copy of owner/repo up to date. After the first
+// sync only items updated since the previous one are fetched and merged in.
+func (s *Store) Sync(ctx context.Context, client *github.Client, owner, repo string, opts SyncOptions) (SyncResult, error) {
+	name := owner + "/" + repo
+	state, err := s.readState(name)
+	if err != nil {
+		return SyncResult{}, err
+	}
+
+	var since time.Time
+	incremental := !opts.Full && state != nil && state.covers(opts)
+	if incremental {
+		// Keep the wider coverage of earlier syncs: updated items replace
+		// their stored copies, so they must be fetched the same way, and
+		// LastUpdated must not move past items of a kind not fetched
+		since = state.LastUpdated
+		opts.Kind = state.Kind
+		opts.IncludeComments = state.IncludeComments
+		opts.MaxComments = state.MaxComments
+	}
+
+	started := time.Now()
+	fetched, err := client.FetchIssues(ctx, owner, repo, github.FetchOptions{
+		State:           "all",
+		Since:           since,
+		Kind:            opts.Kind,
+		IncludeComments: opts.IncludeComments,
+		MaxComments:     opts.MaxComments,
+	})
+	if err != nil {
+		return SyncResult{}, err
+	}
+
+	stored, err := s.load(name)
+	if err != nil {
+		return SyncResult{}, err
+	}
+	byNumber := make(map[int]github.Issue, len(stored)+len(fetched))
+	for _, issue := range stored {
+		byNumber[issue.Number] = issue
+	}
+	for _, issue := range fetched {
+		byNumber[issue.Number] = issue
+	}
+
+	issues := make([]github.Issue, 0, len(byNumber))
+	newState := syncState{
+		Repo:            name,
+		SyncedAt:        started,
+		Kind:            opts.Kind,
+		IncludeComments: opts.IncludeComments,
+		MaxComments:     opts.MaxComments,
+	}
+	for _, issue := range byNumber {
+		issues = append(issues, issue)
+		if issue.UpdatedAt.After(newState.LastUpdated) {
+			newState.LastUpdated = issue.UpdatedAt
+		}
+	}
+	sort.Slice(issues, func(i, j int) bool { return issues[i].Number < issues[j].Number })
+
+	if err := s.save(name, issues); err != nil {
+		return SyncResult{}, err
+	}
+	if err := writeJSONFile(filepath.Join(s.repoDir(name), stateFile), func(f *os.File) error {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		return enc.Encode(newState)
+	}); err != nil {
+		return SyncResult{}, fmt.Errorf("save sync state for %s: %w", name, err)
+	}
+
+	return SyncResult{Fetched: len(fetched), Total: len(issues), Incremental: incremental}, nil
+}
+
+// LastSync returns when repo was last synced, or the zero time if never.
+func (s *Store) LastSync(repo string) (time.Time, error) {
+	state, err := s.readState(repo)
+	if err != nil || state == nil {
+		return time.Time{}, err
+	}
+	return state.SyncedAt, nil
+}
+
+// Issues returns the stored issues of repo that match q, newest first.
+func (s *Store) Issues(repo string, q Query) ([]github.Issue, error) {
+	stored, err := s.load(repo)
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil {
+		return nil, fmt.Errorf("no stored issues for %s, sync it first", repo)
+	}
+
+	var issues []github.Issue
+	for i := len(stored) - 1; i >= 0; i-- {
+		issue := stored[i]
+		if !q.Matches(issue) {
+			continue
+		}
+
+		issue.Repo = repo
+		if !q.IncludeComments {
+			issue.Thread = nil
+		} else if q.MaxComments > 0 && len(issue.Thread) > q.MaxComments {
+			issue.Thread = issue.Thread[:q.MaxComments]
+		}
+		issues = append(issues, issue)
+
+		if q.MaxItems > 0 && len(issues) == q.MaxItems {
+			break
+		}
+	}
+	return issues, nil
+}
+
+// Matches reports whether issue passes the filters of q; MaxItems and the
+// comment settings do not apply.
+func (q Query) Matches(issue github.Issue) bool {
+	if !q.Kind.Matches(issue) {
+		return false
+	}
+	if q.State != "" && q.State != "all" && issue.State != q.State {
+		return false
+	}
+
+	for _, label := range q.Labels {
+		label = strings.TrimSpace(label)
+		if label == "" {
+			continue
+		}
+		found := false
+		for _, l := range issue.Labels {
+			if strings.EqualFold(l.Name, label) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	var keywords []string
+	for _, keyword := range q.Keywords {
+		if keyword = strings.ToLower(strings.TrimSpace(keyword)); keyword != "" {
+			keywords = append(keywords, keyword)
+		}
+	}
+	if len(keywords) == 0 {
+		return true
+	}
+
+	text := []string{strings.ToLower(issue.Title), strings.ToLower(issue.Body)}
+	for _, c := range issue.Thread {
+		text = append(text, strings.ToLower(c.Body))
+	}
+	for _, keyword := range keywords {
+		for _, t := range text {
+			if strings.Contains(t, keyword) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// load reads a repository's stored issues; nil means it was never synced.
+func (s *Store) load(repo string) ([]github.Issue, error) {
+	f, err := os.Open(filepath.Join(s.repoDir(repo), issuesFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open stored issues for %s: %w", repo, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	issues := []github.Issue{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var issue github.Issue
+		if err := json.Unmarshal(scanner.Bytes(), &issue); err != nil {
+			return nil, fmt.Errorf("read stored issues for %s: line %d: %w", repo, line, err)
+		}
+		issues = append(issues, issue)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read stored issues for %s: %w", repo, err)
+	}
+	return issues, nil
+}
+
+func (s *Store) save(repo string, issues []github.Issue) error {
+	err := writeJSONFile(filepath.Join(s.repoDir(repo), issuesFile), func(f *os.File) error {
+		w := bufio.NewWriter(f)
+		enc := json.NewEncoder(w)
+		for _, issue := range issues {
+			if err := enc.Encode(issue); err != nil {
+				return err
+			}
+		}
+		return w.Flush()
+	})
+	if err != nil {
+		return fmt.Errorf("save issues for %s: %w", repo, err)
+	}
+	return nil
+}
+
+func (s *Store) readState(repo string) (*syncState, error) {
+	data, err := os.ReadFile(filepath.Join(s.repoDir(repo), stateFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read sync state for %s: %w", repo, err)
+	}
+
+	var state syncState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("read sync state for %s: %w", repo, err)
+	}
+	return &state, nil
+}
+
+// writeJSONFile replaces path atomically with what write produces, so an
+// interrupted sync leaves the previous copy intact.
+func writeJSONFile(path string, write func(f *os.File) error) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	writeErr := write(tmp)
+	closeErr := tmp.Close()
+	if err := errors.Join(writeErr, closeErr); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}